@@ -9,13 +9,14 @@ import (
 	`os`
 	`strconv`
 
-	`github.com/ambientsound/rex/pkg/rekordbox/color`
-	`github.com/ambientsound/rex/pkg/rekordbox/column`
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox`
 	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/diff`
 	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/pdb`
 	`github.com/ambientsound/rex/pkg/rekordbox/track`
-	`github.com/ambientsound/rex/pkg/rekordbox/unknown17`
-	`github.com/ambientsound/rex/pkg/rekordbox/unknown18`
+	`github.com/ambientsound/rex/pkg/rekordbox/verify`
 )
 
 /*
@@ -27,6 +28,8 @@ var (
 	printIndex = flag.Bool("index", false, "print contents of index structure")
 	printRows  = flag.Bool("rows", false, "print individual rows")
 	dumb       = flag.Bool("dumb", false, "don't attempt to parse tables")
+	verifyFile = flag.Bool("verify", false, "check the file for structural problems, and exit with an error if any are found")
+	diffFiles  = flag.Bool("diff", false, "print field-level differences between two files")
 )
 
 func main() {
@@ -40,6 +43,10 @@ func main() {
 func run() error {
 	flag.Parse()
 
+	if *diffFiles {
+		return run_diff(flag.Args())
+	}
+
 	f, err := os.Open(flag.Args()[0])
 	if err != nil {
 		return err
@@ -49,6 +56,9 @@ func run() error {
 	if *dumb {
 		return run_ordered(f)
 	}
+	if *verifyFile {
+		return run_verify(f)
+	}
 	return run_parser(f)
 }
 
@@ -86,6 +96,11 @@ func run_parser(f io.ReadWriteSeeker) error {
 			for i := range table.Index.IndexEntries {
 				fmt.Printf(" %04x", table.Index.IndexEntries[i])
 			}
+			for _, overflow := range table.Overflow {
+				for i := range overflow.IndexEntries {
+					fmt.Printf(" %04x", overflow.IndexEntries[i])
+				}
+			}
 			fmt.Printf("\n")
 		}
 
@@ -94,8 +109,8 @@ func run_parser(f io.ReadWriteSeeker) error {
 			fmt.Printf("  %s Page: idx=%02x rows=%3d deleted=%3d used=%4d free=%4d large=%010s tx=%04x flags=%02x u3=%04x u4=%04x u5=%04x\n",
 				tableName,
 				pg.Header.PageIndex,
-				pg.Header.NumRowsSmall,
-				int(pg.Header.NumRowsSmall)-pg.ActiveRows(),
+				pg.NumRows(),
+				pg.NumRows()-pg.ActiveRows(),
 				pg.Header.NextHeapWriteOffset,
 				pg.Header.FreeSize,
 				lr,
@@ -106,7 +121,7 @@ func run_parser(f io.ReadWriteSeeker) error {
 				pg.DataHeader.Unknown5,
 			)
 
-			totalRows += int(pg.Header.NumRowsSmall)
+			totalRows += pg.NumRows()
 			totalActive += pg.ActiveRows()
 			totalRowSets += len(pg.RowSets)
 
@@ -123,33 +138,21 @@ func run_parser(f io.ReadWriteSeeker) error {
 			}
 
 			for rowNum, rowref := range pg.HeapPositions() {
-				if table.Type == page.Type_Tracks {
-
-					tr := &track.Track{}
-					err = pg.UnmarshalRow(tr, rowref.HeapPosition)
-					if err != nil {
-						fmt.Printf("      Track: io.EOF\n")
-					} else {
-						fmt.Printf("      Track: heap=%04x id=%04x shift=%02x exists=%-5v path=%q\n", rowref.HeapPosition, tr.Id, tr.IndexShift, rowref.Exists, tr.FilePath)
-					}
-				} else if table.Type == page.Type_Unknown18 {
-					row := &unknown18.Unknown18{}
-					err = pg.UnmarshalRow(row, rowref.HeapPosition)
-					fmt.Printf("      %#v\n", row)
-				} else if table.Type == page.Type_Columns {
-					row := &column.Column{}
-					err = pg.UnmarshalRow(row, rowref.HeapPosition)
-					fmt.Printf("      %04x %#v\n", rowref.HeapPosition, row)
-				} else if table.Type == page.Type_Colors {
-					row := &color.Color{}
-					err = pg.UnmarshalRow(row, rowref.HeapPosition)
-					fmt.Printf("      %04x %#v\n", rowref.HeapPosition, row)
-				} else if table.Type == page.Type_Unknown17 {
-					row := &unknown17.Unknown17{}
-					err = pg.UnmarshalRow(row, rowref.HeapPosition)
-					fmt.Printf("      %#v\n", row)
-				} else {
+				row := rekordbox.NewRow(table.Type)
+				if row == nil {
 					fmt.Printf("      Row: index=%03d heap=%04x exists=%v\n", rowNum, rowref.HeapPosition, rowref.Exists)
+					continue
+				}
+				err = pg.UnmarshalRow(row, rowref.HeapPosition)
+				if err != nil {
+					fmt.Printf("      Row: index=%03d heap=%04x exists=%v error=%q\n", rowNum, rowref.HeapPosition, rowref.Exists, err)
+					continue
+				}
+				switch row := row.(type) {
+				case *track.Track:
+					fmt.Printf("      Track: heap=%04x id=%04x shift=%02x exists=%-5v path=%q\n", rowref.HeapPosition, row.Id, row.IndexShift, rowref.Exists, row.FilePath)
+				default:
+					fmt.Printf("      %04x exists=%-5v %#v\n", rowref.HeapPosition, rowref.Exists, row)
 				}
 			}
 		}
@@ -160,20 +163,70 @@ func run_parser(f io.ReadWriteSeeker) error {
 	return nil
 }
 
+func run_verify(f io.ReadWriteSeeker) error {
+	db, err := dbengine.Open(f)
+	if err != nil {
+		return err
+	}
+
+	problems := verify.Verify(db)
+	for _, problem := range problems {
+		fmt.Printf("%s\n", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+
+	fmt.Printf("No problems found.\n")
+	return nil
+}
+
+func run_diff(paths []string) error {
+	if len(paths) != 2 {
+		return fmt.Errorf("-diff needs two files")
+	}
+
+	dbs := make([]*dbengine.DbEngine, len(paths))
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dbs[i], err = dbengine.Open(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	differences, err := diff.Compare(dbs[0], dbs[1])
+	if err != nil {
+		return err
+	}
+	for _, difference := range differences {
+		fmt.Printf("%s\n", difference)
+	}
+	fmt.Printf("%d differences found.\n", len(differences))
+
+	return nil
+}
+
 func run_ordered(f io.ReadWriteSeeker) error {
 	flag.Parse()
 
 	const blocksize = 4096
 	buf := make([]byte, blocksize)
 
-	db, err := dbengine.Open(f)
+	// The file header is read directly, as the tables may be too broken to open the file with dbengine.
+	globals := &pdb.FileHeader{}
+	err := marshal.UnpackFrom(f, globals)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("%05x: numtables=%d, next_unused_page=%05x, sequence=%d\n", 0, db.Globals.NumTables, db.Globals.NextUnusedPage*blocksize, db.Globals.Sequence)
+	fmt.Printf("%05x: numtables=%d, next_unused_page=%05x, sequence=%d\n", 0, globals.NumTables, globals.NextUnusedPage*blocksize, globals.Sequence)
 
-	for _, ptr := range db.Globals.Pointers {
+	for _, ptr := range globals.Pointers {
 		fmt.Printf("%-20s first=%02x last=%02x empty_candidate=%02x\n", ptr.Type.String()[5:], ptr.FirstPage, ptr.LastPage, ptr.EmptyCandidate)
 	}
 
@@ -194,17 +247,12 @@ func run_ordered(f io.ReadWriteSeeker) error {
 		}
 
 		header := &page.Header{}
-		idxheader := &page.IndexHeader{}
 		r := bytes.NewReader(buf)
 
 		err = binary.Read(r, binary.LittleEndian, header)
 		if err != nil {
 			return err
 		}
-		err = binary.Read(r, binary.LittleEndian, idxheader)
-		if err != nil {
-			return err
-		}
 
 		// isIndex := header.PageFlags & 0x64
 
@@ -229,6 +277,12 @@ func run_ordered(f io.ReadWriteSeeker) error {
 				fmt.Printf("\n")
 				continue
 			}
+			idxheader := &page.IndexHeader{}
+			err = marshal.UnpackFrom(r, idxheader)
+			if err != nil {
+				fmt.Printf(" <BROKEN: %s>\n", err)
+				continue
+			}
 			if idxheader.NumEntries == 0 {
 				fmt.Printf(" <EMPTY>\n")
 				continue
@@ -240,15 +294,7 @@ func run_ordered(f io.ReadWriteSeeker) error {
 				idxheader.Unknown2,
 				idxheader.FirstEmptyEntry,
 			)
-			for idxnum := 0; idxnum < int(idxheader.NextOffset); idxnum++ {
-				var unknown uint32
-				err = binary.Read(r, binary.LittleEndian, &unknown)
-				if err != nil {
-					return err
-				}
-				// if unknown == 0x1ffffff8 {
-				// 	break
-				// }
+			for idxnum, unknown := range idxheader.IndexEntries {
 				s := strconv.FormatUint(uint64(unknown), 2)
 				fmt.Printf("> pos=%02d dec=%04d hex=%08x bin=%032s\n", idxnum, unknown, unknown, s)
 			}
@@ -262,7 +308,7 @@ func run_ordered(f io.ReadWriteSeeker) error {
 			fmt.Printf(" <DATA>")
 			fmt.Printf(" rows=%d\n", header.NumRowsSmall)
 		default:
-			panic("cannot handle it")
+			fmt.Printf(" <UNKNOWN FLAGS %02x>\n", header.PageFlags)
 		}
 	}
 
@@ -0,0 +1,191 @@
+package main
+
+import (
+	`sort`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/ambientsound/rex/pkg/rekordbox/album`
+	`github.com/ambientsound/rex/pkg/rekordbox/artist`
+	`github.com/ambientsound/rex/pkg/rekordbox/artwork`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/genre`
+	`github.com/ambientsound/rex/pkg/rekordbox/key`
+	`github.com/ambientsound/rex/pkg/rekordbox/label`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/playlist`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+)
+
+// Rows already present in an export database.
+// When updating an existing export, only rows that are not found here are written.
+type existingRows struct {
+	tracks    map[string]library.ID // Keyed by file path on the export media.
+	artists   map[string]bool
+	albums    map[string]bool // Keyed by title and album artist.
+	genres    map[string]bool
+	labels    map[string]bool
+	keys      map[string]bool
+	playlists map[string]bool     // Keyed by full name, including parent folders.
+	entries   map[uint32][]uint32 // Track IDs of each playlist, in entry order.
+	sortOrder map[uint32]uint32   // Next sort order in each folder.
+}
+
+func newExistingRows() *existingRows {
+	return &existingRows{
+		tracks:    make(map[string]library.ID),
+		artists:   make(map[string]bool),
+		albums:    make(map[string]bool),
+		genres:    make(map[string]bool),
+		labels:    make(map[string]bool),
+		keys:      make(map[string]bool),
+		playlists: make(map[string]bool),
+		entries:   make(map[uint32][]uint32),
+		sortOrder: make(map[uint32]uint32),
+	}
+}
+
+// Returns the sort order of a new playlist or folder, placing it after all other entries in the folder.
+func (existing *existingRows) nextSortOrder(parentID uint32) uint32 {
+	sortOrder := existing.sortOrder[parentID]
+	existing.sortOrder[parentID]++
+	return sortOrder
+}
+
+// Returns true if a playlist in the export already has exactly these tracks, in this order.
+func (existing *existingRows) sameEntries(playlistID uint32, trackIDs []uint32) bool {
+	entries := existing.entries[playlistID]
+	if len(entries) != len(trackIDs) {
+		return false
+	}
+	for i := range entries {
+		if entries[i] != trackIDs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Read the rows of an existing export database, and seed the library with them,
+// so that new objects are assigned IDs that do not conflict with the existing ones.
+func readExistingRows(db *dbengine.DbEngine, lib *library.Library) (*existingRows, error) {
+	existing := newExistingRows()
+
+	tracks, err := dbengine.ReadRows[track.Track](db, page.Type_Tracks)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range tracks {
+		existing.tracks[row.FilePath] = library.ID(row.Id)
+		lib.Tracks().Reserve(library.ID(row.Id))
+	}
+
+	artists, err := dbengine.ReadRows[artist.Artist](db, page.Type_Artists)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range artists {
+		existing.artists[row.Name] = true
+		lib.Artists().InsertWithID(&library.Artist{Name: row.Name}, library.ID(row.Id))
+	}
+
+	albums, err := dbengine.ReadRows[album.Album](db, page.Type_Albums)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range albums {
+		a := &library.Album{
+			Artist: lib.Artists().GetByID(library.ID(row.ArtistId)),
+			Title:  row.Name,
+		}
+		existing.albums[a.GetName()] = true
+		lib.Albums().InsertWithID(a, library.ID(row.Id))
+	}
+
+	genres, err := dbengine.ReadRows[genre.Genre](db, page.Type_Genres)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range genres {
+		existing.genres[row.Name] = true
+		lib.Genres().InsertWithID(&library.Genre{Name: row.Name}, library.ID(row.Id))
+	}
+
+	labels, err := dbengine.ReadRows[label.Label](db, page.Type_Labels)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range labels {
+		existing.labels[row.Name] = true
+		lib.Labels().InsertWithID(&library.Label{Name: row.Name}, library.ID(row.Id))
+	}
+
+	// Artwork images can not be compared to new ones, so their IDs are only reserved.
+	artworks, err := dbengine.ReadRows[artwork.Artwork](db, page.Type_Artwork)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range artworks {
+		lib.Artworks().Reserve(library.ID(row.Id))
+	}
+
+	keys, err := dbengine.ReadRows[key.Key](db, page.Type_Keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range keys {
+		existing.keys[row.Name] = true
+		lib.Keys().InsertWithID(&library.Key{Name: row.Name}, library.ID(row.Id))
+	}
+
+	// The playlist tree is copied into the library, so that new playlists
+	// can be added to existing folders.
+	err = mediascanner.ReadPlaylistTree(db, lib)
+	if err != nil {
+		return nil, err
+	}
+	for _, pl := range lib.Playlists().All() {
+		existing.playlists[pl.GetName()] = true
+	}
+
+	playlists, err := dbengine.ReadRows[playlist.Playlist](db, page.Type_PlaylistTree)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range playlists {
+		if row.SortOrder >= existing.sortOrder[row.ParentId] {
+			existing.sortOrder[row.ParentId] = row.SortOrder + 1
+		}
+	}
+
+	entries, err := dbengine.ReadRows[playlist.Entry](db, page.Type_PlaylistEntries)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].EntryIndex < entries[j].EntryIndex
+	})
+	for _, row := range entries {
+		existing.entries[row.PlaylistID] = append(existing.entries[row.PlaylistID], row.TrackID)
+	}
+
+	return existing, nil
+}
+
+// Returns the IDs of the playlists and folders in the export that are no longer read from the source.
+// Folders are kept as long as they hold at least one playlist from the source.
+func (existing *existingRows) orphanedPlaylists(lib *library.Library, updated map[*library.Playlist]bool) map[uint32]bool {
+	keep := make(map[*library.Playlist]bool)
+	for pl := range updated {
+		for ; pl != nil; pl = pl.Parent {
+			keep[pl] = true
+		}
+	}
+	orphaned := make(map[uint32]bool)
+	for _, pl := range lib.Playlists().All() {
+		if existing.playlists[pl.GetName()] && !keep[pl] {
+			orphaned[uint32(lib.Playlists().ID(pl))] = true
+		}
+	}
+	return orphaned
+}
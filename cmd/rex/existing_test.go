@@ -0,0 +1,46 @@
+package main
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/stretchr/testify/assert`
+	`github.com/stretchr/testify/require`
+)
+
+func TestExistingRows_OrphanedPlaylists(t *testing.T) {
+	lib := library.New()
+	existing := newExistingRows()
+
+	// Playlists read from the export.
+	insert := func(path ...string) *library.Playlist {
+		folder, err := lib.PlaylistFolder(path[:len(path)-1])
+		require.NoError(t, err)
+		pl := &library.Playlist{Name: path[len(path)-1]}
+		lib.InsertPlaylist(folder, pl)
+		return pl
+	}
+	kept := insert(playlistsFolder, "House", "Deep")
+	insert(playlistsFolder, "House", "Renamed")
+	insert(cratesFolder, "Deleted")
+	for _, pl := range lib.Playlists().All() {
+		existing.playlists[pl.GetName()] = true
+	}
+
+	// Playlists read from the source; one of them is new.
+	added := &library.Playlist{Name: "New"}
+	folder, err := lib.PlaylistFolder([]string{playlistsFolder})
+	require.NoError(t, err)
+	lib.InsertPlaylist(folder, added)
+	updated := map[*library.Playlist]bool{kept: true, added: true}
+
+	orphaned := existing.orphanedPlaylists(lib, updated)
+
+	names := make([]string, 0)
+	for _, pl := range lib.Playlists().All() {
+		if orphaned[uint32(lib.Playlists().ID(pl))] {
+			names = append(names, pl.GetName())
+		}
+	}
+	assert.ElementsMatch(t, []string{"Playlists/House/Renamed", "Crates", "Crates/Deleted"}, names)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	`context`
+	`database/sql`
+	`flag`
+	`fmt`
+	`os`
+	`path/filepath`
+	`strings`
+	`time`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/ambientsound/rex/pkg/mixxx`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+)
+
+// Playlist names in exports made by earlier versions of REX are prefixed
+// with the kind of Mixxx object they came from.
+const (
+	playlistPrefix = "P: "
+	cratePrefix    = "C: "
+)
+
+// Import playlists and history from a USB export into the Mixxx database.
+func runImport(args []string) error {
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	basedir := flags.String("root", "./", "Root path of USB drive")
+	mixxxdbPath := flags.String("mixxxdb", defaultMixxxDbPath(), "Path to Mixxx database")
+	historyDateString := flags.String("historydate", "", "Date of history playlists as YYYY-MM-DD (default: modification time of the export)")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	*basedir, err = filepath.Abs(*basedir)
+	if err != nil {
+		return err
+	}
+
+	// Read the export
+	exportFile := filepath.Join(*basedir, "PIONEER", "rekordbox", "export.pdb")
+	f, err := os.Open(exportFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Players write history playlists to the export while playing,
+	// so its modification time is the best guess of when the tracks were played.
+	historyDate, err := exportDate(f, *historyDateString)
+	if err != nil {
+		return err
+	}
+
+	db, err := dbengine.Open(f)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", exportFile, err)
+	}
+	lib, err := mediascanner.LibraryFromPdb(db, *basedir)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", exportFile, err)
+	}
+	histories, err := mediascanner.HistoryFromPdb(db, lib)
+	if err != nil {
+		return fmt.Errorf("read history from %s: %w", exportFile, err)
+	}
+	fmt.Printf("PIONEER database opened: %s\n", exportFile)
+	fmt.Printf("Found %d tracks, %d playlists and %d history playlists\n", len(lib.Tracks().All()), len(lib.Playlists().All()), len(histories))
+
+	// Open Mixxx database
+	sqliteHandle, err := sql.Open("sqlite3", *mixxxdbPath)
+	if err != nil {
+		return fmt.Errorf("open Mixxx database: %w", err)
+	}
+	defer sqliteHandle.Close()
+	tx, err := sqliteHandle.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	mixxxdb := mixxx.New(tx)
+	fmt.Printf("Mixxx database opened: %s\n", *mixxxdbPath)
+
+	// Match tracks in the export against the Mixxx library
+	srcTracks, err := mixxxdb.ListTracks(ctx)
+	if err != nil {
+		return err
+	}
+	mixxxIDs := make(map[*library.Track]int64, len(srcTracks))
+	candidates := make([]*library.Track, 0, len(srcTracks))
+	for _, track := range srcTracks {
+		if track.MixxxDeleted.Int64 != 0 {
+			continue
+		}
+		t := mediascanner.TrackFromMixxx(track, mixxx.KeyNotationStandard)
+		mixxxIDs[t] = track.ID
+		candidates = append(candidates, t)
+	}
+	matcher := library.NewMatcher(candidates)
+
+	trackIDs := func(tracks []*library.Track) []int64 {
+		ids := make([]int64, 0, len(tracks))
+		for _, t := range tracks {
+			match := matcher.Match(t)
+			if match == nil {
+				fmt.Printf("  Not found in Mixxx library: %s - %s (%s)\n", t.Artist, t.Title, t.Path)
+				continue
+			}
+			ids = append(ids, mixxxIDs[match])
+		}
+		return ids
+	}
+
+	// Existing playlists are left untouched
+	mixxxPlaylists, err := mixxxdb.ListPlaylists(ctx)
+	if err != nil {
+		return err
+	}
+	existingPlaylists := make(map[string]bool)
+	for _, plist := range mixxxPlaylists {
+		existingPlaylists[plist.Name.String] = true
+	}
+
+	mixxxCrates, err := mixxxdb.ListCrates(ctx)
+	if err != nil {
+		return err
+	}
+	crates := make(map[string]int64)
+	for _, crate := range mixxxCrates {
+		crates[crate.Name] = crate.ID
+	}
+
+	createPlaylist := func(name string, hidden int64, created time.Time, tracks []*library.Track) error {
+		if existingPlaylists[name] {
+			fmt.Printf("Playlist %q already exists, skipping\n", name)
+			return nil
+		}
+		created = created.UTC().Truncate(time.Second)
+		date := created.Format(mixxx.DateTimeFormat)
+		playlistID, err := mixxxdb.CreatePlaylist(ctx, mixxx.CreatePlaylistParams{
+			Name:         sql.NullString{String: name, Valid: true},
+			Hidden:       hidden,
+			DateCreated:  sql.NullString{String: date, Valid: true},
+			DateModified: sql.NullString{String: date, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		existingPlaylists[name] = true
+		ids := trackIDs(tracks)
+		for i, trackID := range ids {
+			err = mixxxdb.AddPlaylistTrack(ctx, mixxx.AddPlaylistTrackParams{
+				PlaylistID:      sql.NullInt64{Int64: playlistID, Valid: true},
+				TrackID:         sql.NullInt64{Int64: trackID, Valid: true},
+				Position:        sql.NullInt64{Int64: int64(i + 1), Valid: true},
+				PlDatetimeAdded: sql.NullString{String: date, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Playlist %q imported with %d/%d tracks\n", name, len(ids), len(tracks))
+		return nil
+	}
+
+	addToCrate := func(name string, tracks []*library.Track) error {
+		crateID, found := crates[name]
+		if !found {
+			crateID, err = mixxxdb.CreateCrate(ctx, name)
+			if err != nil {
+				return err
+			}
+			crates[name] = crateID
+		}
+		ids := trackIDs(tracks)
+		for _, trackID := range ids {
+			err = mixxxdb.AddCrateTrack(ctx, mixxx.AddCrateTrackParams{
+				CrateID: crateID,
+				TrackID: trackID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Crate %q imported with %d/%d tracks\n", name, len(ids), len(tracks))
+		return nil
+	}
+
+	// Playlists in the Crates folder are added to crates, the rest become playlists.
+	// Nested folders are flattened into the name.
+	now := time.Now()
+	for _, pl := range lib.Playlists().All() {
+		if pl.Folder {
+			continue
+		}
+		path := pl.Path()
+		switch {
+		case len(path) > 1 && path[0] == cratesFolder:
+			err = addToCrate(strings.Join(path[1:], library.PlaylistSeparator), pl.Tracks)
+		case len(path) > 1 && path[0] == playlistsFolder:
+			err = createPlaylist(strings.Join(path[1:], library.PlaylistSeparator), mixxx.PlaylistVisible, now, pl.Tracks)
+		case strings.HasPrefix(pl.Name, cratePrefix):
+			err = addToCrate(strings.TrimPrefix(pl.GetName(), cratePrefix), pl.Tracks)
+		default:
+			err = createPlaylist(strings.TrimPrefix(pl.GetName(), playlistPrefix), mixxx.PlaylistVisible, now, pl.Tracks)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// History playlists are named after the date they were played,
+	// and show up in the History section of Mixxx.
+	for _, pl := range histories {
+		name := historyDate.Format("2006-01-02") + " " + pl.Name
+		err = createPlaylist(name, mixxx.PlaylistSetLog, historyDate, pl.Tracks)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err == nil {
+		fmt.Printf("Finished successfully.\n")
+	}
+
+	return err
+}
+
+// Returns the date given on the command line, or the modification time of the file.
+func exportDate(f *os.File, date string) (time.Time, error) {
+	if len(date) > 0 {
+		return time.ParseInLocation("2006-01-02", date, time.Local)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return stat.ModTime(), nil
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	`context`
-	`database/sql`
+	`errors`
 	`flag`
 	`fmt`
-	`io`
 	`os`
+	`os/signal`
 	`path/filepath`
+	`runtime`
+	`strings`
 
 	`github.com/ambientsound/rex/pkg/library`
 	`github.com/ambientsound/rex/pkg/mediascanner`
@@ -24,10 +26,25 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Root folders of the playlist tree.
+const (
+	playlistsFolder = "Playlists"
+	cratesFolder    = "Crates"
+	foldersFolder   = "Folders"
+)
+
 func main() {
-	err := run()
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		err = runImport(os.Args[2:])
+	} else {
+		err = run()
+	}
 	if err != nil {
 		fmt.Printf("fatal error: %s\n", err)
+		if errors.Is(err, dbengine.ErrIndexFull) {
+			fmt.Printf("Use -overflow-index to continue the index on extra index pages, and test the export on your player.\n")
+		}
 		os.Exit(1)
 	}
 }
@@ -39,30 +56,60 @@ func run() error {
 	fmt.Printf("This software is neither supported nor endorsed by Pioneer.\n")
 	fmt.Printf("Please do not rely on it for serious use.\n")
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// Interrupting the program stops all running encoders.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 	lib := library.New()
 
 	// Initialize options
 	basedir := flag.String("root", "./", "Root path of USB drive")
 	trackDir := flag.String("trackdir", "rex", "Where on the USB drive to put exported files, relative to root path")
-	forceOverwrite := flag.Bool("f", false, "Overwrite export file if it exists")
+	forceOverwrite := flag.Bool("f", false, "Overwrite export file if it exists, instead of adding new tracks to it")
 	mixxxdbPath := flag.String("mixxxdb", defaultMixxxDbPath(), "Path to Mixxx database")
+	keyNotationName := flag.String("keynotation", "standard", "Musical key notation, either 'standard' or 'camelot'")
+	colorMapping := flag.String("colors", "", "Comma separated list of Mixxx track colors mapped to rekordbox colors, e.g. 'ff0000=Red,00ff00=None'; others are mapped to the nearest color")
+	targetName := flag.String("target", mediascanner.DefaultTarget, "Player model to export for, one of: "+strings.Join(mediascanner.TargetNames(), ", ")+"; files the player can not play are transcoded to MP3")
+	transcodeName := flag.String("transcode", mediascanner.DefaultTranscodeProfile, "Format of transcoded files, one of: "+strings.Join(mediascanner.TranscodeProfileNames(), ", ")+", or a profile from -profiles")
+	profilesFile := flag.String("profiles", "", "JSON file with additional transcode profiles")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "Number of tracks to encode and analyze in parallel")
+	scanDir := flag.String("scan", "", "Export audio files found in this directory instead of the Mixxx library; directories and M3U files become playlists")
+	separator := flag.String("separator", "/", "Separator for nested folders in playlist and crate names; empty to disable nesting")
+	overflowIndexes := flag.Bool("overflow-index", false, "Continue the indexes of very large tables on extra index pages, which players may not read")
 	flag.Parse()
 
-	*basedir, err = filepath.Abs(*basedir)
+	keyNotation, err := mixxx.KeyNotationFromString(*keyNotationName)
 	if err != nil {
 		return err
 	}
 
-	// Open Mixxx database
-	sqliteHandle, err := sql.Open("sqlite3", *mixxxdbPath)
+	colors, err := color.ParseMapping(*colorMapping)
+	if err != nil {
+		return err
+	}
+
+	target, err := mediascanner.TargetFromString(*targetName)
+	if err != nil {
+		return err
+	}
+
+	if len(*profilesFile) > 0 {
+		err = mediascanner.LoadTranscodeProfiles(*profilesFile)
+		if err != nil {
+			return err
+		}
+	}
+	profile, err := mediascanner.TranscodeProfileFromString(*transcodeName)
+	if err != nil {
+		return err
+	}
+	if !target.SupportsProfile(profile) {
+		return fmt.Errorf("target '%s' can not play files transcoded with profile '%s'", target.Name, profile.Name)
+	}
+
+	*basedir, err = filepath.Abs(*basedir)
 	if err != nil {
-		return fmt.Errorf("open Mixxx database: %w", err)
+		return err
 	}
-	defer sqliteHandle.Close()
-	mixxxdb := mixxx.New(sqliteHandle)
-	fmt.Printf("Mixxx database opened: %s\n", *mixxxdbPath)
 
 	// Create output directories
 	outputPath := filepath.Join(*basedir, "PIONEER", "rekordbox")
@@ -80,261 +127,422 @@ func run() error {
 		return err
 	}
 
-	// Open output file for writing
+	// Open the existing database for update, or create a new one.
 	outputFile := filepath.Join(outputPath, "export.pdb")
 	outputFile, err = filepath.Abs(outputFile)
 	if err != nil {
 		return err
 	}
-	var flags = os.O_CREATE | os.O_RDWR
-	if *forceOverwrite {
-		flags |= os.O_TRUNC
+	_, err = os.Stat(outputFile)
+	update := err == nil && !*forceOverwrite
+
+	var db *dbengine.DbEngine
+	var out *os.File
+	existing := newExistingRows()
+
+	if update {
+		out, err = os.OpenFile(outputFile, os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		db, err = dbengine.Open(out)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", outputFile, err)
+		}
+		existing, err = readExistingRows(db, lib)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", outputFile, err)
+		}
+		fmt.Printf("PIONEER database opened for update: %s (%d tracks)\n", outputFile, len(existing.tracks))
+	} else {
+		out, err = os.OpenFile(outputFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		db = dbengine.New(out)
+
+		// Create all tables found in a typical rekordbox export.
+		for _, pageType := range pdb.TableOrder {
+			err = db.CreateTable(pageType)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("PIONEER database created: %s\n", outputFile)
 	}
-	out, err := os.OpenFile(outputFile, flags, 0644)
-	if err != nil {
-		return err
+
+	db.OverflowIndexes = *overflowIndexes
+	if db.OverflowIndexes {
+		fmt.Printf("WARNING: overflow index pages are enabled. Players may not read them; test the export before relying on it.\n")
 	}
-	defer out.Close()
-	fmt.Printf("PIONEER database created: %s\n", outputFile)
 
-	// Scan Mixxx library for tracks
-	srcTracks, err := mixxxdb.ListTracks(ctx)
+	// Read tracks and playlists from a directory tree, or the Mixxx library.
+	var src *source
+	var sourceDir string
+	if len(*scanDir) > 0 {
+		sourceDir, err = filepath.Abs(*scanDir)
+		if err != nil {
+			return err
+		}
+		src, err = readDir(ctx, sourceDir, *jobs)
+	} else {
+		src, err = readMixxx(ctx, *mixxxdbPath, keyNotation, *separator)
+	}
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Found %d tracks in Mixxx database\n", len(srcTracks))
-	trackCandidates := make(map[string]*library.Track, len(srcTracks))
-	for i, track := range srcTracks {
-		t := mediascanner.TrackFromMixxx(track)
-		trackCandidates[t.Path] = t
-		fmt.Printf("\033[2K\r[%6d/%6d] %s", i+1, len(srcTracks), t.Title)
-	}
-	fmt.Printf("\033[2K\r")
-	fmt.Printf("Tracks imported.\n")
+	trackCandidates := src.tracks
+	numCandidates := len(trackCandidates)
 
-	// Create playlists
-	mixxPlaylists, err := mixxxdb.ListPlaylists(ctx)
+	// Whether a track is copied or transcoded depends on its audio stream, and decides its output path.
+	err = probeSources(ctx, src, *jobs)
 	if err != nil {
 		return err
 	}
-	for _, plist := range mixxPlaylists {
-		if plist.Hidden > 0 {
-			continue
+
+	// Scanned files are named after their path relative to the scanned directory.
+	// Names are chosen for all tracks at once, before rendering in parallel, so that no two tracks
+	// are rendered to the same file.
+	sourcePaths := make([]string, 0, len(trackCandidates))
+	for path := range trackCandidates {
+		sourcePaths = append(sourcePaths, path)
+	}
+	outputNames := mediascanner.OutputNames(sourcePaths, sourceDir)
+
+	// Add a track to the library, re-using the track ID if it is already in the export.
+	libraryTrack := func(path string) (*library.Track, error) {
+		t := lib.Tracks().GetByName(path)
+		if t != nil {
+			return t, nil
 		}
-		tracks, err := mixxxdb.ListPlaylistTracks(ctx, sql.NullInt64{Int64: plist.ID, Valid: true})
+		t, found := trackCandidates[path]
+		if !found {
+			return nil, fmt.Errorf("database incoherent: %s not found", path)
+		}
+		t.OutputPath = mediascanner.OutputPath(t, *trackDir, outputNames[path], target, profile)
+		id, found := existing.tracks[mediascanner.MediaPath(t, *basedir)]
+		if found {
+			lib.Tracks().InsertWithID(t, id)
+		} else {
+			lib.InsertTrack(t)
+		}
+		delete(trackCandidates, path)
+		return t, nil
+	}
+
+	// Add a playlist to the playlist tree, creating its parent folders.
+	// Playlists that are already in the export get their tracks replaced.
+	// Playlists in the export that are not read from the source are not in this set, and are removed.
+	updated := make(map[*library.Playlist]bool)
+	insertPlaylist := func(path []string, pplist *library.Playlist) error {
+		folder, err := lib.PlaylistFolder(path[:len(path)-1])
 		if err != nil {
 			return err
 		}
+		pplist.Name = path[len(path)-1]
+		found := lib.Playlists().GetByName(strings.Join(path, library.PlaylistSeparator))
+		if found == nil {
+			lib.InsertPlaylist(folder, pplist)
+			updated[pplist] = true
+			return nil
+		}
+		if found.Folder {
+			return fmt.Errorf("playlist %q has the same name as a folder", pplist.Name)
+		}
+		found.Tracks = pplist.Tracks
+		updated[found] = true
+		return nil
+	}
+
+	// Create playlists
+	for _, plist := range src.playlists {
 		pplist := &library.Playlist{
-			ID:     library.ID(plist.ID),
-			Name:   "P: " + plist.Name.String,
-			Tracks: make([]*library.Track, 0),
-		}
-		for _, track := range tracks {
-			t := lib.Tracks().GetByName(track.Path.String)
-			if t == nil {
-				var found bool
-				t, found = trackCandidates[track.Path.String]
-				if !found {
-					return fmt.Errorf("database incoherent: %s not found", track.Path.String)
-				}
-				lib.InsertTrack(t)
-				delete(trackCandidates, track.Path.String)
+			Tracks: make([]*library.Track, 0, len(plist.tracks)),
+		}
+		for _, path := range plist.tracks {
+			t, err := libraryTrack(path)
+			if err != nil {
+				return err
 			}
 			pplist.Tracks = append(pplist.Tracks, t)
 		}
-		lib.Playlists().Insert(pplist)
-		fmt.Printf("Playlist %q loaded with %d tracks\n", pplist.Name, len(pplist.Tracks))
+		err = insertPlaylist(plist.path, pplist)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %q loaded with %d tracks\n", plist.kind, plist.name(), len(pplist.Tracks))
 	}
 
-	// Create playlists from crates
-	mixxCrates, err := mixxxdb.ListCrates(ctx)
-	if err != nil {
-		return err
+	// Tracks that are already in the export are neither analyzed nor written again.
+	newTracks := make([]*library.Track, 0)
+	for _, t := range lib.Tracks().All() {
+		_, found := existing.tracks[mediascanner.MediaPath(t, *basedir)]
+		if !found {
+			newTracks = append(newTracks, t)
+		}
 	}
-	for _, crate := range mixxCrates {
-		if crate.Show.Int64 == 0 {
-			continue
+
+	library.ResolveAlbumArtists(lib.Tracks().All())
+
+	fmt.Printf("Tracks marked for export: %6d used/%6d total, %6d new\n", len(lib.Tracks().All()), numCandidates, len(newTracks))
+	fmt.Printf("Copying or encoding tracks to %s\n", *trackDir)
+
+	// Tracks are rendered in parallel; progress is reported in track order.
+	// Partially written files are removed if rendering fails or is interrupted.
+	err = parallel(ctx, len(newTracks), *jobs, func(ctx context.Context, i int) (string, error) {
+		t := newTracks[i]
+		result, err := mediascanner.RenderTo(ctx, t, target, profile)
+		if err != nil {
+			return "", fmt.Errorf("render %q: %w", t.OutputPath, err)
 		}
-		if crate.Locked.Int64 > 0 {
-			continue
+		// Technical metadata of the source file is wrong after transcoding.
+		probe, err := mediascanner.ProbeMetadata(ctx, t.OutputPath)
+		if err != nil {
+			return "", fmt.Errorf("probe %q: %w", t.OutputPath, err)
 		}
-		tracks, err := mixxxdb.ListCrateTracks(ctx, crate.ID)
+		mediascanner.ApplyOutputProbe(t, probe)
+		return result.Action + " " + t.OutputPath, nil
+	}, func(i int, result string) {
+		fmt.Printf("\033[2K\r[%6d/%6d] %s", i+1, len(newTracks), result)
+	})
+	if err != nil {
+		fmt.Printf("\n")
+		return err
+	}
+
+	fmt.Printf("\033[2K\r")
+	fmt.Printf("All tracks copied to destination\n")
+	fmt.Printf("Rendering waveforms and writing analysis files...\n")
+
+	err = parallel(ctx, len(newTracks), *jobs, func(ctx context.Context, i int) (string, error) {
+		t := newTracks[i]
+		waveform, err := mediascanner.ScanWaveform(ctx, t.OutputPath)
 		if err != nil {
-			return err
+			return "", fmt.Errorf("scan waveform for %q: %w", t.OutputPath, err)
 		}
-		pplist := &library.Playlist{
-			ID:     library.ID(crate.ID),
-			Name:   "C: " + crate.Name,
-			Tracks: make([]*library.Track, 0),
-		}
-		for _, track := range tracks {
-			t := lib.Tracks().GetByName(track.Path.String)
-			if t == nil {
-				var found bool
-				t, found = trackCandidates[track.Path.String]
-				if !found {
-					return fmt.Errorf("database incoherent: %s not found", track.Path.String)
-				}
-				lib.InsertTrack(t)
-				delete(trackCandidates, track.Path.String)
-			}
-			pplist.Tracks = append(pplist.Tracks, t)
+		err = mediascanner.WriteAnalysis(lib, t, waveform, *basedir)
+		if err != nil {
+			return "", fmt.Errorf("write analysis for %q: %w", t.OutputPath, err)
 		}
-		lib.Playlists().Insert(pplist)
-		fmt.Printf("Crate %q loaded with %d tracks\n", pplist.Name, len(pplist.Tracks))
+		return t.OutputPath, nil
+	}, func(i int, result string) {
+		fmt.Printf("\033[2K\r[%6d/%6d] %s", i+1, len(newTracks), result)
+	})
+	if err != nil {
+		fmt.Printf("\n")
+		return err
 	}
 
-	fmt.Printf("Tracks marked for export: %6d used/%6d total\n", len(lib.Tracks().All()), len(srcTracks))
-	fmt.Printf("Copying or encoding tracks to %s\n", *trackDir)
+	fmt.Printf("\033[2K\r")
+	fmt.Printf("Extracting cover art...\n")
 
-	for i, t := range lib.Tracks().All() {
-		fmt.Printf("\r[%6d/%6d] ", i+1, len(lib.Tracks().All()))
-		result, err := mediascanner.RenderTo(ctx, t, *trackDir)
+	// Tracks are exported without artwork if their cover art can not be read.
+	for i, t := range newTracks {
+		fmt.Printf("\033[2K\r[%6d/%6d] %s", i+1, len(newTracks), t.OutputPath)
+		err = mediascanner.ExportArtwork(ctx, lib, t, *basedir)
 		if err != nil {
-			fmt.Printf("\n")
-			return fmt.Errorf("render %q: %w\n", t.OutputPath, err)
+			fmt.Printf("\nExport cover art for %q: %s\n", t.Path, err)
 		}
-		fmt.Printf("\033[2K\r[%6d/%6d] %s %s", i+1, len(lib.Tracks().All()), result.Action, t.OutputPath)
 	}
 
 	fmt.Printf("\033[2K\r")
-	fmt.Printf("All tracks copied to destination\n")
+
 	fmt.Printf("Writing PDB file...\n")
 
-	// Intermediary type for storing "INSERT statements"
-	type Insert struct {
-		Type page.Type
-		Row  page.Row
-	}
-	inserts := make([]Insert, 0)
-
-	// Create PDB data types for tracks, artists, albums and playlists.
-	tracks := lib.Tracks().All()
-	for i := range tracks {
-		pdbtrack := mediascanner.PdbTrack(lib, tracks[i], *basedir)
-		inserts = append(inserts, Insert{
-			Type: page.Type_Tracks,
-			Row:  &pdbtrack,
-		})
-	}
-
-	artists := lib.Artists().All()
-	for i := range artists {
-		pdbartist := mediascanner.PdbArtist(lib, artists[i])
-		inserts = append(inserts, Insert{
-			Type: page.Type_Artists,
-			Row:  &pdbartist,
-		})
-	}
-
-	albums := lib.Albums().All()
-	for i := range albums {
-		pdbalbum := mediascanner.PdbAlbum(lib, albums[i])
-		inserts = append(inserts, Insert{
-			Type: page.Type_Albums,
-			Row:  &pdbalbum,
-		})
-	}
-
-	// Generate playlists
-	playlists := lib.Playlists().All()
-	for playlistID := range playlists {
-		pl := &playlist.Playlist{
-			PlaylistHeader: playlist.PlaylistHeader{
-				Id: uint32(playlistID),
-			},
-			Name: playlists[playlistID].GetName(),
-		}
-		inserts = append(inserts, Insert{
-			Type: page.Type_PlaylistTree,
-			Row:  pl,
-		})
-		for trackIndex, t := range playlists[playlistID].Tracks {
-			ent := &playlist.Entry{
-				EntryIndex: uint32(trackIndex + 1),
-				TrackID:    uint32(lib.Tracks().ID(t)),
-				PlaylistID: uint32(playlistID),
-			}
-			inserts = append(inserts, Insert{
-				Type: page.Type_PlaylistEntries,
-				Row:  ent,
-			})
+	// Create PDB data types for tracks, artists, albums, genres, labels, keys, artwork and playlists.
+	// Rows are appended to the last page of each table, and new pages are allocated as needed.
+	for _, t := range newTracks {
+		pdbtrack := mediascanner.PdbTrack(lib, t, *basedir, colors)
+		err = db.InsertRow(page.Type_Tracks, &pdbtrack)
+		if err != nil {
+			return err
 		}
 	}
 
-	for _, uk := range unknown17.InitialDataset {
-		inserts = append(inserts, Insert{
-			Type: page.Type_Unknown17,
-			Row:  uk,
-		})
+	for _, a := range lib.Artists().All() {
+		if existing.artists[a.Name] {
+			continue
+		}
+		pdbartist := mediascanner.PdbArtist(lib, a)
+		err = db.InsertRow(page.Type_Artists, &pdbartist)
+		if err != nil {
+			return err
+		}
 	}
 
-	for _, uk := range unknown18.InitialDataset {
-		inserts = append(inserts, Insert{
-			Type: page.Type_Unknown18,
-			Row:  uk,
-		})
+	for _, a := range lib.Albums().All() {
+		if existing.albums[a.GetName()] {
+			continue
+		}
+		pdbalbum := mediascanner.PdbAlbum(lib, a)
+		err = db.InsertRow(page.Type_Albums, &pdbalbum)
+		if err != nil {
+			return err
+		}
 	}
 
-	for _, uk := range color.InitialDataset {
-		inserts = append(inserts, Insert{
-			Type: page.Type_Colors,
-			Row:  uk,
-		})
+	for _, g := range lib.Genres().All() {
+		if existing.genres[g.Name] {
+			continue
+		}
+		pdbgenre := mediascanner.PdbGenre(lib, g)
+		err = db.InsertRow(page.Type_Genres, &pdbgenre)
+		if err != nil {
+			return err
+		}
 	}
 
-	for _, uk := range column.InitialDataset {
-		inserts = append(inserts, Insert{
-			Type: page.Type_Columns,
-			Row:  uk,
-		})
+	for _, l := range lib.Labels().All() {
+		if existing.labels[l.Name] {
+			continue
+		}
+		pdblabel := mediascanner.PdbLabel(lib, l)
+		err = db.InsertRow(page.Type_Labels, &pdblabel)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Initialize the database.
-	db := dbengine.New(out)
+	for _, k := range lib.Keys().All() {
+		if existing.keys[k.Name] {
+			continue
+		}
+		pdbkey := mediascanner.PdbKey(lib, k)
+		err = db.InsertRow(page.Type_Keys, &pdbkey)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Create all tables found in a typical rekordbox export.
-	for _, pageType := range pdb.TableOrder {
-		err = db.CreateTable(pageType)
+	// Artwork read from an existing export is not in the library, so all artwork here is new.
+	for _, a := range lib.Artworks().All() {
+		pdbartwork := mediascanner.PdbArtwork(lib, a)
+		err = db.InsertRow(page.Type_Artwork, &pdbartwork)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
 
-	// Generate data pages with the inserts generated earlier.
-	// When a data page is full, it is inserted into the db.
-	// This is a quick and dirty way for export ONLY,
-	// it will not work to modify existing databases.
-	dataPages := make(map[page.Type]*page.Data)
-	for _, insert := range inserts {
-		if dataPages[insert.Type] == nil {
-			dataPages[insert.Type] = page.NewPage(insert.Type)
+	// Playlists that are already in the export and have changed get all their entries rewritten,
+	// so that removed tracks disappear and the remaining ones are numbered from one.
+	rewrite := make(map[uint32]bool)
+	for pl := range updated {
+		playlistID := uint32(lib.Playlists().ID(pl))
+		if !existing.sameEntries(playlistID, trackIDs(lib, pl)) {
+			rewrite[playlistID] = true
 		}
-		err = dataPages[insert.Type].Insert(insert.Row)
-		if err == nil {
-			continue
+	}
+
+	// Playlists and folders that are no longer in the source are removed with their entries,
+	// so that renamed and deleted playlists do not linger in the export.
+	orphaned := existing.orphanedPlaylists(lib, updated)
+	removed, err := dbengine.DeleteRows(db, page.Type_PlaylistTree, func(row *playlist.Playlist) bool {
+		return orphaned[row.Id]
+	})
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		fmt.Printf("Removed %d playlists and folders that are no longer in the source\n", removed)
+	}
+
+	_, err = dbengine.DeleteRows(db, page.Type_PlaylistEntries, func(row *playlist.Entry) bool {
+		return rewrite[row.PlaylistID] || orphaned[row.PlaylistID]
+	})
+	if err != nil {
+		return err
+	}
+
+	// Generate the playlist tree.
+	var writePlaylists func(playlists []*library.Playlist, parentID uint32) error
+	writePlaylists = func(playlists []*library.Playlist, parentID uint32) error {
+		for _, pl := range playlists {
+			playlistID := uint32(lib.Playlists().ID(pl))
+			if orphaned[playlistID] {
+				continue
+			}
+			if !existing.playlists[pl.GetName()] {
+				row := &playlist.Playlist{
+					PlaylistHeader: playlist.PlaylistHeader{
+						ParentId:  parentID,
+						SortOrder: existing.nextSortOrder(parentID),
+						Id:        playlistID,
+					},
+					Name: pl.Name,
+				}
+				if pl.Folder {
+					row.RawIsFolder = 1
+				}
+				err := db.InsertRow(page.Type_PlaylistTree, row)
+				if err != nil {
+					return err
+				}
+			}
+			if pl.Folder {
+				err := writePlaylists(pl.Children, playlistID)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if !rewrite[playlistID] {
+				continue
+			}
+			for i, trackID := range trackIDs(lib, pl) {
+				err := db.InsertRow(page.Type_PlaylistEntries, &playlist.Entry{
+					EntryIndex: uint32(i + 1),
+					TrackID:    trackID,
+					PlaylistID: playlistID,
+				})
+				if err != nil {
+					return err
+				}
+			}
 		}
-		if err == io.ErrShortWrite {
-			err = db.InsertPage(dataPages[insert.Type])
+		return nil
+	}
+	err = writePlaylists(lib.RootPlaylists(), 0)
+	if err != nil {
+		return err
+	}
+
+	// Static tables are only written when the database is created.
+	if !update {
+		for _, uk := range unknown17.InitialDataset {
+			err = db.InsertRow(page.Type_Unknown17, uk)
 			if err != nil {
-				panic(err)
+				return err
 			}
-			dataPages[insert.Type] = nil
-			continue
 		}
-		panic(err)
-	}
 
-	// Insert the remainding pages.
-	for _, pg := range dataPages {
-		if pg == nil {
-			continue
+		for _, uk := range unknown18.InitialDataset {
+			err = db.InsertRow(page.Type_Unknown18, uk)
+			if err != nil {
+				return err
+			}
 		}
-		err = db.InsertPage(pg)
-		if err != nil {
-			panic(err)
+
+		for _, uk := range color.InitialDataset {
+			err = db.InsertRow(page.Type_Colors, uk)
+			if err != nil {
+				return err
+			}
 		}
+
+		for _, uk := range column.InitialDataset {
+			err = db.InsertRow(page.Type_Columns, uk)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write the remaining pages.
+	err = db.Commit()
+	if err != nil {
+		return err
 	}
 
 	// Flush buffers and exit program.
@@ -343,7 +551,34 @@ func run() error {
 		fmt.Printf("Finished successfully.\n")
 	}
 
-	return nil
+	return err
+}
+
+// IDs of the tracks in a playlist, in playlist order.
+func trackIDs(lib *library.Library, pl *library.Playlist) []uint32 {
+	ids := make([]uint32, len(pl.Tracks))
+	for i, t := range pl.Tracks {
+		ids[i] = uint32(lib.Tracks().ID(t))
+	}
+	return ids
+}
+
+// Split a playlist name into the names of nested folders and the playlist itself.
+func splitPlaylistName(name, separator string) []string {
+	if len(separator) == 0 {
+		return []string{name}
+	}
+	names := make([]string, 0)
+	for _, s := range strings.Split(name, separator) {
+		s = strings.TrimSpace(s)
+		if len(s) > 0 {
+			names = append(names, s)
+		}
+	}
+	if len(names) == 0 {
+		return []string{name}
+	}
+	return names
 }
 
 func defaultMixxxDbPath() string {
@@ -0,0 +1,89 @@
+package main
+
+import (
+	`context`
+	`sync`
+)
+
+// Process items 0 to n-1 with at most jobs concurrent calls to fn.
+//
+// Results are passed to report in order, as soon as all previous items have finished.
+// The first error cancels the context passed to the remaining calls, and is returned.
+func parallel(ctx context.Context, n, jobs int, fn func(ctx context.Context, i int) (string, error), report func(i int, result string)) error {
+	type result struct {
+		i      int
+		output string
+		err    error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	indices := make(chan int)
+	results := make(chan result)
+	wg := &sync.WaitGroup{}
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if ctx.Err() != nil {
+					results <- result{i, "", ctx.Err()}
+					continue
+				}
+				output, err := fn(ctx, i)
+				results <- result{i, output, err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(indices)
+		for i := 0; i < n; i++ {
+			select {
+			case indices <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var err error
+	next := 0
+	pending := make(map[int]string)
+	for r := range results {
+		if err != nil {
+			continue
+		}
+		if r.err != nil {
+			err = r.err
+			cancel()
+			continue
+		}
+		pending[r.i] = r.output
+		for {
+			output, found := pending[next]
+			if !found {
+				break
+			}
+			delete(pending, next)
+			report(next, output)
+			next++
+		}
+	}
+
+	if err == nil && next < n {
+		err = ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	`context`
+	`errors`
+	`fmt`
+	`sync/atomic`
+	`testing`
+	`time`
+
+	`github.com/stretchr/testify/assert`
+)
+
+func TestParallel(t *testing.T) {
+	var running, maxRunning int32
+	reported := make([]int, 0)
+
+	err := parallel(context.Background(), 20, 4, func(ctx context.Context, i int) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		// Later items finish first.
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		return fmt.Sprint(i), nil
+	}, func(i int, result string) {
+		assert.Equal(t, fmt.Sprint(i), result)
+		reported = append(reported, i)
+	})
+
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, maxRunning, int32(4))
+	assert.Len(t, reported, 20)
+	for i, r := range reported {
+		assert.Equal(t, i, r)
+	}
+}
+
+func TestParallel_Error(t *testing.T) {
+	failure := errors.New("failure")
+
+	err := parallel(context.Background(), 100, 2, func(ctx context.Context, i int) (string, error) {
+		if i == 3 {
+			return "", failure
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Millisecond):
+			return "", nil
+		}
+	}, func(i int, result string) {
+		assert.Less(t, i, 3)
+	})
+
+	assert.ErrorIs(t, err, failure)
+}
+
+func TestParallel_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := parallel(ctx, 10, 2, func(ctx context.Context, i int) (string, error) {
+		return "", nil
+	}, func(i int, result string) {})
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
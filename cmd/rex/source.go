@@ -0,0 +1,287 @@
+package main
+
+import (
+	`context`
+	`database/sql`
+	`fmt`
+	`path/filepath`
+	`sort`
+	`strings`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/ambientsound/rex/pkg/mixxx`
+)
+
+// Tracks and playlists to be exported, read from a Mixxx database or a directory tree.
+type source struct {
+	tracks    map[string]*library.Track // Keyed by file path.
+	playlists []sourcePlaylist
+}
+
+// A playlist and its place in the playlist tree.
+type sourcePlaylist struct {
+	kind   string   // Shown in progress messages, e.g. "Playlist" or "Crate".
+	path   []string // Names of the root folder, nested folders, and the playlist itself.
+	tracks []string // File paths of tracks in the playlist.
+}
+
+func (p sourcePlaylist) name() string {
+	return p.path[len(p.path)-1]
+}
+
+// Read tracks, playlists and crates from a Mixxx database.
+// Hidden playlists and crates, and locked crates, are skipped.
+// Playlist and crate names are split into nested folders by separator.
+func readMixxx(ctx context.Context, dbPath string, keyNotation mixxx.KeyNotation, separator string) (*source, error) {
+	sqliteHandle, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open Mixxx database: %w", err)
+	}
+	defer sqliteHandle.Close()
+	mixxxdb := mixxx.New(sqliteHandle)
+	fmt.Printf("Mixxx database opened: %s\n", dbPath)
+
+	srcTracks, err := mixxxdb.ListTracks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Found %d tracks in Mixxx database\n", len(srcTracks))
+	src := &source{
+		tracks:    make(map[string]*library.Track, len(srcTracks)),
+		playlists: make([]sourcePlaylist, 0),
+	}
+	for i, track := range srcTracks {
+		t := mediascanner.TrackFromMixxx(track, keyNotation)
+		cues, err := mixxxdb.ListTrackCues(ctx, track.ID)
+		if err != nil {
+			return nil, err
+		}
+		t.Cues = mediascanner.CuesFromMixxx(cues, track.Samplerate.Int64)
+		src.tracks[t.Path] = t
+		fmt.Printf("\033[2K\r[%6d/%6d] %s", i+1, len(srcTracks), t.Title)
+	}
+	fmt.Printf("\033[2K\r")
+	fmt.Printf("Tracks imported.\n")
+
+	mixxPlaylists, err := mixxxdb.ListPlaylists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, plist := range mixxPlaylists {
+		if plist.Hidden > 0 {
+			continue
+		}
+		tracks, err := mixxxdb.ListPlaylistTracks(ctx, sql.NullInt64{Int64: plist.ID, Valid: true})
+		if err != nil {
+			return nil, err
+		}
+		pl := sourcePlaylist{
+			kind:   "Playlist",
+			path:   append([]string{playlistsFolder}, splitPlaylistName(plist.Name.String, separator)...),
+			tracks: make([]string, 0, len(tracks)),
+		}
+		for _, track := range tracks {
+			pl.tracks = append(pl.tracks, track.Path.String)
+		}
+		src.playlists = append(src.playlists, pl)
+	}
+
+	mixxCrates, err := mixxxdb.ListCrates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, crate := range mixxCrates {
+		if crate.Show.Int64 == 0 {
+			continue
+		}
+		if crate.Locked.Int64 > 0 {
+			continue
+		}
+		tracks, err := mixxxdb.ListCrateTracks(ctx, crate.ID)
+		if err != nil {
+			return nil, err
+		}
+		pl := sourcePlaylist{
+			kind:   "Crate",
+			path:   append([]string{cratesFolder}, splitPlaylistName(crate.Name, separator)...),
+			tracks: make([]string, 0, len(tracks)),
+		}
+		for _, track := range tracks {
+			pl.tracks = append(pl.tracks, track.Path.String)
+		}
+		src.playlists = append(src.playlists, pl)
+	}
+
+	return src, nil
+}
+
+// Read tracks from audio files in a directory tree, probing each file for metadata.
+// Each directory with audio files becomes a playlist, and M3U files become playlists.
+// Files that can not be probed are skipped.
+func readDir(ctx context.Context, dir string, jobs int) (*source, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	scan, err := mediascanner.ScanDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Found %d audio files in %s\n", len(scan.Files), dir)
+
+	tracks := make([]*library.Track, len(scan.Files))
+	err = parallel(ctx, len(scan.Files), jobs, func(ctx context.Context, i int) (string, error) {
+		path := scan.Files[i]
+		probe, err := mediascanner.ProbeMetadata(ctx, path)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return fmt.Sprintf("skipping %s: %s", path, err), nil
+		}
+		tracks[i] = mediascanner.TrackFromFile(nil, path, *probe)
+		return tracks[i].Title, nil
+	}, func(i int, result string) {
+		if tracks[i] == nil {
+			fmt.Printf("\033[2K\r%s\n", result)
+			return
+		}
+		fmt.Printf("\033[2K\r[%6d/%6d] %s", i+1, len(scan.Files), result)
+	})
+	if err != nil {
+		fmt.Printf("\n")
+		return nil, err
+	}
+	fmt.Printf("\033[2K\r")
+	fmt.Printf("Tracks imported.\n")
+
+	src := &source{
+		tracks:    make(map[string]*library.Track, len(tracks)),
+		playlists: folderPlaylists(dir, scan.Files),
+	}
+	for _, t := range tracks {
+		if t != nil {
+			src.tracks[t.Path] = t
+		}
+	}
+
+	for _, path := range scan.Playlists {
+		files, err := mediascanner.ReadM3U(path)
+		if err != nil {
+			return nil, fmt.Errorf("read playlist %q: %w", path, err)
+		}
+		pl := sourcePlaylist{
+			kind:   "Playlist",
+			path:   []string{playlistsFolder, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))},
+			tracks: make([]string, 0, len(files)),
+		}
+		// Only tracks found in the scanned directory can be exported.
+		for _, file := range files {
+			if _, found := src.tracks[file]; !found {
+				fmt.Printf("Playlist %q: skipping %s, not found in %s\n", pl.name(), file, dir)
+				continue
+			}
+			pl.tracks = append(pl.tracks, file)
+		}
+		src.playlists = append(src.playlists, pl)
+	}
+
+	// Files that could not be probed are left out of the folder playlists.
+	for i := range src.playlists {
+		tracks := src.playlists[i].tracks[:0]
+		for _, path := range src.playlists[i].tracks {
+			if _, found := src.tracks[path]; found {
+				tracks = append(tracks, path)
+			}
+		}
+		src.playlists[i].tracks = tracks
+	}
+
+	return src, nil
+}
+
+// Group audio files into one playlist per directory, nested in folders mirroring the directory tree.
+// Files in a directory that also has subdirectories with audio files go into a playlist
+// named after the directory, inside the folder of the same name.
+func folderPlaylists(root string, files []string) []sourcePlaylist {
+	byDir := make(map[string][]string)
+	dirs := make([]string, 0)
+	for _, path := range files {
+		dir := filepath.Dir(path)
+		if _, found := byDir[dir]; !found {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], path)
+	}
+	sort.Strings(dirs)
+
+	// Any audio file below a directory, except directly in it, makes it a folder.
+	isFolder := func(dir string) bool {
+		for _, other := range dirs {
+			if strings.HasPrefix(other, dir+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	playlists := make([]sourcePlaylist, 0, len(dirs))
+	for _, dir := range dirs {
+		path := []string{foldersFolder}
+		rel, err := filepath.Rel(root, dir)
+		if err == nil && rel != "." {
+			path = append(path, strings.Split(rel, string(filepath.Separator))...)
+		}
+		if dir == root || isFolder(dir) {
+			path = append(path, filepath.Base(dir))
+		}
+		playlists = append(playlists, sourcePlaylist{
+			kind:   "Folder",
+			path:   path,
+			tracks: byDir[dir],
+		})
+	}
+	return playlists
+}
+
+// Probe the audio files of tracks used in playlists, unless they were probed when they were read.
+// Labels and remixers are only found in the file tags,
+// and the codec, sample rate and sample depth decide whether the target can play the file.
+func probeSources(ctx context.Context, src *source, jobs int) error {
+	tracks := make([]*library.Track, 0)
+	seen := make(map[string]bool)
+	for _, pl := range src.playlists {
+		for _, path := range pl.tracks {
+			t := src.tracks[path]
+			if t == nil || len(t.Codec) > 0 || seen[path] {
+				continue
+			}
+			seen[path] = true
+			tracks = append(tracks, t)
+		}
+	}
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Probing %d audio files...\n", len(tracks))
+	err := parallel(ctx, len(tracks), jobs, func(ctx context.Context, i int) (string, error) {
+		t := tracks[i]
+		probe, err := mediascanner.ProbeMetadata(ctx, t.Path)
+		if err != nil {
+			return "", fmt.Errorf("probe %q: %w", t.Path, err)
+		}
+		mediascanner.ApplyProbeTags(t, probe)
+		mediascanner.ApplySourceProbe(t, probe)
+		return t.Path, nil
+	}, func(i int, result string) {
+		fmt.Printf("\033[2K\r[%6d/%6d] %s", i+1, len(tracks), result)
+	})
+	if err != nil {
+		fmt.Printf("\n")
+		return err
+	}
+	fmt.Printf("\033[2K\r")
+	return nil
+}
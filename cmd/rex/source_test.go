@@ -0,0 +1,24 @@
+package main
+
+import (
+	`testing`
+
+	`github.com/stretchr/testify/assert`
+)
+
+func TestFolderPlaylists(t *testing.T) {
+	playlists := folderPlaylists("/music", []string{
+		"/music/intro.mp3",
+		"/music/House/Deep/a.mp3",
+		"/music/House/b.mp3",
+		"/music/House/Deep/c.mp3",
+		"/music/Techno/d.mp3",
+	})
+
+	assert.Equal(t, []sourcePlaylist{
+		{kind: "Folder", path: []string{"Folders", "music"}, tracks: []string{"/music/intro.mp3"}},
+		{kind: "Folder", path: []string{"Folders", "House", "House"}, tracks: []string{"/music/House/b.mp3"}},
+		{kind: "Folder", path: []string{"Folders", "House", "Deep"}, tracks: []string{"/music/House/Deep/a.mp3", "/music/House/Deep/c.mp3"}},
+		{kind: "Folder", path: []string{"Folders", "Techno"}, tracks: []string{"/music/Techno/d.mp3"}},
+	}, playlists)
+}
@@ -0,0 +1,67 @@
+package library
+
+import (
+	`path/filepath`
+	`strings`
+)
+
+// Album artist of compilations.
+const VariousArtists = "Various Artists"
+
+// Album artist names that are commonly used for compilations.
+var variousArtistsAliases = []string{
+	"various artists",
+	"various",
+	"va",
+	"v.a.",
+	"v/a",
+}
+
+func isVariousArtists(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, alias := range variousArtistsAliases {
+		if name == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// Set the album artist of all tracks on an album.
+//
+// Tracks without an album artist are credited to the track artist, unless the
+// album is a compilation. Albums are detected as compilations when tracks in the same
+// directory, with the same album title, have different artists. Compilations are
+// credited to Various Artists, also when the album artist is spelled differently, e.g. "VA".
+func ResolveAlbumArtists(tracks []*Track) {
+	type albumDir struct {
+		dir   string
+		title string
+	}
+
+	artists := make(map[albumDir]string)
+	compilations := make(map[albumDir]bool)
+	for _, t := range tracks {
+		if len(t.AlbumArtist) > 0 || len(t.Album) == 0 {
+			continue
+		}
+		key := albumDir{filepath.Dir(t.Path), t.Album}
+		artist, found := artists[key]
+		if found && !strings.EqualFold(artist, t.Artist) {
+			compilations[key] = true
+		}
+		artists[key] = t.Artist
+	}
+
+	for _, t := range tracks {
+		switch {
+		case isVariousArtists(t.AlbumArtist):
+			t.AlbumArtist = VariousArtists
+		case len(t.AlbumArtist) > 0 || len(t.Album) == 0:
+		case compilations[albumDir{filepath.Dir(t.Path), t.Album}]:
+			t.AlbumArtist = VariousArtists
+		default:
+			t.AlbumArtist = t.Artist
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package library_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestResolveAlbumArtists(t *testing.T) {
+	tracks := []*library.Track{
+		{Path: "/music/abba/01.mp3", Artist: "ABBA", Album: "Greatest Hits"},
+		{Path: "/music/abba/02.mp3", Artist: "ABBA", Album: "Greatest Hits"},
+		{Path: "/music/queen/01.mp3", Artist: "Queen", Album: "Greatest Hits"},
+		{Path: "/music/mix/01.mp3", Artist: "Ame", Album: "Summer Mix"},
+		{Path: "/music/mix/02.mp3", Artist: "Dixon", Album: "Summer Mix"},
+		{Path: "/music/comp/01.mp3", Artist: "Bicep", Album: "Compilation", AlbumArtist: "V/A"},
+		{Path: "/music/single.mp3", Artist: "Bicep", Album: "Glue", AlbumArtist: "Bicep & Friends"},
+		{Path: "/music/loose.mp3", Artist: "Bicep"},
+	}
+
+	library.ResolveAlbumArtists(tracks)
+
+	assert.Equal(t, "ABBA", tracks[0].AlbumArtist)
+	assert.Equal(t, "ABBA", tracks[1].AlbumArtist)
+	assert.Equal(t, "Queen", tracks[2].AlbumArtist)
+	assert.Equal(t, library.VariousArtists, tracks[3].AlbumArtist)
+	assert.Equal(t, library.VariousArtists, tracks[4].AlbumArtist)
+	assert.Equal(t, library.VariousArtists, tracks[5].AlbumArtist)
+	assert.Equal(t, "Bicep & Friends", tracks[6].AlbumArtist)
+	assert.Equal(t, "", tracks[7].AlbumArtist)
+}
+
+func TestLibrary_Album(t *testing.T) {
+	lib := library.New()
+
+	abba := lib.Album("Greatest Hits", "ABBA")
+	queen := lib.Album("Greatest Hits", "Queen")
+
+	assert.NotSame(t, abba, queen)
+	assert.Same(t, abba, lib.Album("Greatest Hits", "ABBA"))
+	assert.Equal(t, "Queen", queen.Artist.Name)
+	assert.Nil(t, lib.Album("Loose Tracks", "").Artist)
+	assert.Len(t, lib.Albums().All(), 3)
+	assert.NotEqual(t, lib.Albums().ID(abba), lib.Albums().ID(queen))
+}
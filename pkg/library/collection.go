@@ -11,22 +11,37 @@ type Collection[T Named] struct {
 	ids     map[ID]T
 	id_rev  map[string]ID
 	names   map[string]T
+	lastID  ID
 }
 
-func (c *Collection[T]) nextID() ID {
-	return ID(len(c.dataset) + 1)
+// The ID assigned to the next object inserted with Insert.
+func (c *Collection[T]) NextID() ID {
+	return c.lastID + 1
 }
 
 func (c *Collection[T]) Insert(data T) ID {
-	id := c.nextID()
+	return c.InsertWithID(data, c.NextID())
+}
+
+// Insert an object with a pre-determined ID, e.g. one read from an existing database.
+// Objects inserted later are assigned IDs higher than this one.
+func (c *Collection[T]) InsertWithID(data T, id ID) ID {
 	name := data.GetName()
 	c.dataset = append(c.dataset, data)
 	c.ids[id] = data
 	c.names[name] = data
 	c.id_rev[name] = id
+	c.Reserve(id)
 	return id
 }
 
+// Make sure that an ID is never assigned to objects inserted later.
+func (c *Collection[T]) Reserve(id ID) {
+	if id > c.lastID {
+		c.lastID = id
+	}
+}
+
 func (c *Collection[T]) All() []T {
 	return c.dataset
 }
@@ -20,3 +20,18 @@ func TestCollection_All(t *testing.T) {
 	assert.Equal(t, "foobar", c.GetByID(id).Name)
 	assert.Equal(t, id, c.ID(artist))
 }
+
+func TestCollection_InsertWithID(t *testing.T) {
+	c := library.NewCollection[*library.Artist]()
+	c.Reserve(3)
+	assert.Equal(t, library.ID(4), c.NextID())
+	existing := &library.Artist{Name: "existing"}
+	assert.Equal(t, library.ID(10), c.InsertWithID(existing, 10))
+
+	artist := &library.Artist{Name: "foobar"}
+	id := c.Insert(artist)
+
+	assert.Equal(t, library.ID(11), id)
+	assert.Equal(t, library.ID(10), c.ID(existing))
+	assert.Equal(t, "existing", c.GetByID(10).Name)
+}
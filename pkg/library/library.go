@@ -4,6 +4,8 @@ package library
 // Not relevant to the Rekordbox format.
 
 import (
+	`fmt`
+	`strings`
 	`time`
 )
 
@@ -14,59 +16,113 @@ type TrackInput struct {
 }
 
 type Track struct {
-	Path        string
-	OutputPath  string
-	Title       string
-	SampleRate  float64
-	FileSize    int
-	Bitrate     int
-	TrackNumber int
-	DiscNumber  int
-	FileType    string
-	Tempo       float64
-	ReleaseDate *time.Time
-	AddedDate   *time.Time
-	SampleDepth int
-	Duration    time.Duration
-	Isrc        string
-	Artist      string
-	Album       string
+	Path           string
+	OutputPath     string
+	Title          string
+	SampleRate     float64
+	FileSize       int
+	Bitrate        int
+	TrackNumber    int
+	DiscNumber     int
+	FileType       string
+	Codec          string // Audio codec of the source file, as named by FFMPEG. Empty until the file is probed.
+	Tempo          float64
+	ReleaseDate    *time.Time
+	AddedDate      *time.Time
+	SampleDepth    int
+	Duration       time.Duration
+	Isrc           string
+	Artist         string
+	Album          string
+	AlbumArtist    string
+	Genre          string
+	Key            string
+	Label          string
+	Remixer        string
+	OriginalArtist string
+	Composer       string
+	Comment        string
+	Beats          []Beat
+	Cues           []Cue
+	CoverArt       string  // Image file, or audio file with embedded cover art.
+	Color          *uint32 // RGB, or nil if the track has no color.
+	Rating         int     // Zero to five stars.
+	Artwork        *Artwork
 
 	// Foreign keys
 	// Artist *Artist
 	// Album  *Album
-	// ArtworkId        uint32
-	// KeyId            uint32
-	// OriginalArtistId uint32
-	// LabelId          uint32
-	// RemixerId        uint32
-	// ComposerId       uint32
-	// GenreId          uint32
-	// ColorId          uint8
 
 	// Unused
 	// PlayCount       uint16
-	// Rating          uint8
-	// Composer          string
 	// Message         string
 	// KuvoPublic      string
-	// AutoloadHotcues string
 	// MixName         string
-	// AnalyzePath     string
-	// Comment         string
 }
 
 func (t *Track) GetName() string {
 	return t.Path
 }
 
+// Hot cues and memory cues.
+// Cues with a zero length are cue points, otherwise they are loops.
+type Cue struct {
+	HotCue int // Zero-based hot cue number, or -1 for memory cues.
+	Time   time.Duration
+	Length time.Duration
+	Label  string
+	Color  uint32 // RGB
+}
+
+func (c Cue) IsHotCue() bool {
+	return c.HotCue >= 0
+}
+
+func (c Cue) IsLoop() bool {
+	return c.Length > 0
+}
+
+// Audio levels for a short segment of a track, normalized to the range 0-1.
+// Low, Mid and High are the energy in the bass, midrange and treble frequency bands.
+type WaveformSegment struct {
+	Peak float64
+	Low  float64
+	Mid  float64
+	High float64
+}
+
+// A single beat in the track's beat grid.
+type Beat struct {
+	Time  time.Duration
+	Tempo float64
+}
+
 type Album struct {
 	Artist *Artist
 	Title  string
 }
 
+// Albums with the same title are distinct if they are credited to different artists.
 func (a *Album) GetName() string {
-	return a.Title
+	if a.Artist == nil {
+		return albumName(a.Title, "")
+	}
+	return albumName(a.Title, a.Artist.Name)
+}
+
+func albumName(title, artist string) string {
+	return title + "\x00" + artist
+}
+
+// Cover art extracted to the export media.
+// Tracks sharing the same image data share the same artwork.
+type Artwork struct {
+	Hash string // Checksum of the source image data.
+	Path string // Thumbnail image, relative to the media root.
+}
+
+func (a *Artwork) GetName() string {
+	return a.Hash
 }
 
 type Artist struct {
@@ -77,21 +133,66 @@ func (a *Artist) GetName() string {
 	return a.Name
 }
 
+type Genre struct {
+	Name string
+}
+
+func (g *Genre) GetName() string {
+	return g.Name
+}
+
+type Label struct {
+	Name string
+}
+
+func (l *Label) GetName() string {
+	return l.Name
+}
+
+type Key struct {
+	Name string
+}
+
+func (k *Key) GetName() string {
+	return k.Name
+}
+
+// Separates the names of folders and playlists in the full name of a playlist.
+const PlaylistSeparator = "/"
+
+// A playlist, or a folder containing other playlists and folders.
 type Playlist struct {
-	ID     ID
-	Name   string
-	Tracks []*Track
+	ID       ID
+	Name     string
+	Tracks   []*Track
+	Folder   bool
+	Parent   *Playlist
+	Children []*Playlist
+}
+
+// Names of the parent folders and the playlist itself, starting at the root level.
+func (p *Playlist) Path() []string {
+	if p.Parent == nil {
+		return []string{p.Name}
+	}
+	return append(p.Parent.Path(), p.Name)
 }
 
+// Full name of the playlist, including its parent folders.
 func (p *Playlist) GetName() string {
-	return p.Name
+	return strings.Join(p.Path(), PlaylistSeparator)
 }
 
 type Library struct {
 	tracks    *Collection[*Track]
 	artists   *Collection[*Artist]
 	albums    *Collection[*Album]
+	artworks  *Collection[*Artwork]
+	genres    *Collection[*Genre]
+	keys      *Collection[*Key]
+	labels    *Collection[*Label]
 	playlists *Collection[*Playlist]
+	root      []*Playlist
 }
 
 func New() *Library {
@@ -99,7 +200,12 @@ func New() *Library {
 		tracks:    NewCollection[*Track](),
 		artists:   NewCollection[*Artist](),
 		albums:    NewCollection[*Album](),
+		artworks:  NewCollection[*Artwork](),
+		genres:    NewCollection[*Genre](),
+		keys:      NewCollection[*Key](),
+		labels:    NewCollection[*Label](),
 		playlists: NewCollection[*Playlist](),
+		root:      make([]*Playlist, 0),
 	}
 }
 
@@ -111,6 +217,22 @@ func (library *Library) Artists() *Collection[*Artist] {
 	return library.artists
 }
 
+func (library *Library) Artworks() *Collection[*Artwork] {
+	return library.artworks
+}
+
+func (library *Library) Genres() *Collection[*Genre] {
+	return library.genres
+}
+
+func (library *Library) Keys() *Collection[*Key] {
+	return library.keys
+}
+
+func (library *Library) Labels() *Collection[*Label] {
+	return library.labels
+}
+
 func (library *Library) Tracks() *Collection[*Track] {
 	return library.tracks
 }
@@ -119,6 +241,46 @@ func (library *Library) Playlists() *Collection[*Playlist] {
 	return library.playlists
 }
 
+// Playlists and folders at the root level, in sort order.
+func (library *Library) RootPlaylists() []*Playlist {
+	return library.root
+}
+
+// Add a playlist or folder to a folder, or to the root level if parent is nil.
+func (library *Library) InsertPlaylist(parent *Playlist, playlist *Playlist) ID {
+	return library.InsertPlaylistWithID(parent, playlist, library.playlists.NextID())
+}
+
+func (library *Library) InsertPlaylistWithID(parent *Playlist, playlist *Playlist, id ID) ID {
+	playlist.Parent = parent
+	if parent == nil {
+		library.root = append(library.root, playlist)
+	} else {
+		parent.Children = append(parent.Children, playlist)
+	}
+	return library.playlists.InsertWithID(playlist, id)
+}
+
+// Returns the folder with the given path, creating it and any missing parent folders.
+func (library *Library) PlaylistFolder(path []string) (*Playlist, error) {
+	var folder *Playlist
+	for i := range path {
+		name := strings.Join(path[:i+1], PlaylistSeparator)
+		existing := library.playlists.GetByName(name)
+		if existing == nil {
+			existing = &Playlist{
+				Name:   path[i],
+				Folder: true,
+			}
+			library.InsertPlaylist(folder, existing)
+		} else if !existing.Folder {
+			return nil, fmt.Errorf("playlist %q is not a folder", name)
+		}
+		folder = existing
+	}
+	return folder, nil
+}
+
 func (library *Library) Artist(name string) *Artist {
 	artist := library.artists.GetByName(name)
 	if artist != nil {
@@ -131,18 +293,59 @@ func (library *Library) Artist(name string) *Artist {
 	return artist
 }
 
-func (library *Library) Album(title string) *Album {
-	album := library.albums.GetByName(title)
+// Returns the album with the given title and album artist, creating it if needed.
+// Albums without an album artist are not linked to an artist.
+func (library *Library) Album(title, artist string) *Album {
+	album := library.albums.GetByName(albumName(title, artist))
 	if album != nil {
 		return album
 	}
 	album = &Album{
 		Title: title,
 	}
+	if len(artist) > 0 {
+		album.Artist = library.Artist(artist)
+	}
 	library.albums.Insert(album)
 	return album
 }
 
+func (library *Library) Genre(name string) *Genre {
+	genre := library.genres.GetByName(name)
+	if genre != nil {
+		return genre
+	}
+	genre = &Genre{
+		Name: name,
+	}
+	library.genres.Insert(genre)
+	return genre
+}
+
+func (library *Library) Key(name string) *Key {
+	key := library.keys.GetByName(name)
+	if key != nil {
+		return key
+	}
+	key = &Key{
+		Name: name,
+	}
+	library.keys.Insert(key)
+	return key
+}
+
+func (library *Library) Label(name string) *Label {
+	label := library.labels.GetByName(name)
+	if label != nil {
+		return label
+	}
+	label = &Label{
+		Name: name,
+	}
+	library.labels.Insert(label)
+	return label
+}
+
 func (library *Library) InsertTrack(track *Track) {
 	library.tracks.Insert(track)
 }
@@ -0,0 +1,34 @@
+package library_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestLibrary_PlaylistFolder(t *testing.T) {
+	lib := library.New()
+
+	folder, err := lib.PlaylistFolder([]string{"Playlists", "House"})
+	assert.NoError(t, err)
+	deep := &library.Playlist{Name: "Deep"}
+	lib.InsertPlaylist(folder, deep)
+
+	// Existing folders are re-used.
+	again, err := lib.PlaylistFolder([]string{"Playlists", "House"})
+	assert.NoError(t, err)
+	assert.Same(t, folder, again)
+
+	assert.Equal(t, "Playlists/House/Deep", deep.GetName())
+	assert.Equal(t, []string{"Playlists", "House", "Deep"}, deep.Path())
+	assert.Len(t, lib.RootPlaylists(), 1)
+	assert.True(t, lib.RootPlaylists()[0].Folder)
+	assert.Equal(t, []*library.Playlist{deep}, folder.Children)
+	assert.Same(t, deep, lib.Playlists().GetByName("Playlists/House/Deep"))
+	assert.Equal(t, library.ID(3), lib.Playlists().ID(deep))
+
+	// Playlists can not contain other playlists.
+	_, err = lib.PlaylistFolder([]string{"Playlists", "House", "Deep"})
+	assert.Error(t, err)
+}
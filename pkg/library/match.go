@@ -0,0 +1,70 @@
+package library
+
+import (
+	`strings`
+	`time`
+)
+
+// Maximum difference in duration between two tracks that are considered the same.
+// Durations in rekordbox databases are rounded to whole seconds.
+const MatchDurationTolerance = 2 * time.Second
+
+type trackTags struct {
+	artist string
+	title  string
+}
+
+// Find tracks that correspond to tracks from another library.
+// Tracks are matched by file path, or by artist, title and duration when the paths differ.
+type Matcher struct {
+	paths map[string]*Track
+	tags  map[trackTags][]*Track
+}
+
+func NewMatcher(tracks []*Track) *Matcher {
+	m := &Matcher{
+		paths: make(map[string]*Track, len(tracks)),
+		tags:  make(map[trackTags][]*Track, len(tracks)),
+	}
+	for _, t := range tracks {
+		m.paths[t.Path] = t
+		key := tagsOf(t)
+		m.tags[key] = append(m.tags[key], t)
+	}
+	return m
+}
+
+func tagsOf(t *Track) trackTags {
+	return trackTags{
+		artist: strings.ToLower(strings.TrimSpace(t.Artist)),
+		title:  strings.ToLower(strings.TrimSpace(t.Title)),
+	}
+}
+
+// Returns the track matching t, or nil if there is no match.
+// If several tracks have the same artist and title, the one closest in duration is returned.
+func (m *Matcher) Match(t *Track) *Track {
+	match := m.paths[t.Path]
+	if match != nil {
+		return match
+	}
+
+	key := tagsOf(t)
+	if len(key.title) == 0 {
+		return nil
+	}
+
+	best := MatchDurationTolerance + 1
+	for _, candidate := range m.tags[key] {
+		diff := candidate.Duration - t.Duration
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < best {
+			best = diff
+			match = candidate
+		}
+	}
+
+	return match
+}
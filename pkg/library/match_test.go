@@ -0,0 +1,40 @@
+package library_test
+
+import (
+	`testing`
+	`time`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestMatcher_Match(t *testing.T) {
+	tracks := []*library.Track{
+		{Path: "/music/a.flac", Artist: "Artist", Title: "Title", Duration: 300 * time.Second},
+		{Path: "/music/b.flac", Artist: "Artist", Title: "Title", Duration: 420 * time.Second},
+		{Path: "/music/c.flac", Artist: "Other", Title: "Song", Duration: 200 * time.Second},
+	}
+	m := library.NewMatcher(tracks)
+
+	// Same path.
+	assert.Same(t, tracks[2], m.Match(&library.Track{Path: "/music/c.flac"}))
+
+	// Different path, same tags, duration within tolerance.
+	assert.Same(t, tracks[1], m.Match(&library.Track{
+		Path:     "/usb/rex/b.mp3",
+		Artist:   "ARTIST ",
+		Title:    "title",
+		Duration: 421 * time.Second,
+	}))
+
+	// Duration is too far off.
+	assert.Nil(t, m.Match(&library.Track{
+		Path:     "/usb/rex/a.mp3",
+		Artist:   "Artist",
+		Title:    "Title",
+		Duration: 310 * time.Second,
+	}))
+
+	// No title.
+	assert.Nil(t, m.Match(&library.Track{Path: "/usb/rex/x.mp3"}))
+}
@@ -0,0 +1,236 @@
+package mediascanner
+
+// Generate Pioneer analysis files for exported tracks.
+
+import (
+	`encoding`
+	`os`
+	`path/filepath`
+	`time`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/mixxx`
+	`github.com/ambientsound/rex/pkg/rekordbox/anlz`
+)
+
+// Mixxx does not store downbeats, so bars are assumed to start at the first beat.
+const beatsPerBar = 4
+
+func beatsFromMixxx(track mixxx.ListTracksRow) []library.Beat {
+	sampleRate := float64(track.Samplerate.Int64)
+	if len(track.Beats) == 0 || sampleRate == 0 {
+		return nil
+	}
+
+	beats, err := mixxx.ParseBeats(track.BeatsVersion.String, track.Beats)
+	if err != nil {
+		return nil
+	}
+
+	frameTime := func(frame float64) time.Duration {
+		return time.Duration(frame / sampleRate * float64(time.Second))
+	}
+
+	result := make([]library.Beat, 0)
+
+	// Beat grids have a constant tempo, expand them to cover the whole track.
+	if beats.Bpm > 0 {
+		interval := time.Duration(60 / beats.Bpm * float64(time.Second))
+		duration := time.Duration(track.Duration.Float64 * float64(time.Second))
+		for tm := frameTime(beats.FirstBeat); tm < duration; tm += interval {
+			result = append(result, library.Beat{
+				Time:  tm,
+				Tempo: beats.Bpm,
+			})
+		}
+		return result
+	}
+
+	// Beat maps have variable tempo, calculated from the distance to the next beat.
+	for i, frame := range beats.Frames {
+		beat := library.Beat{
+			Time:  frameTime(frame),
+			Tempo: track.Bpm.Float64,
+		}
+		if i+1 < len(beats.Frames) && beats.Frames[i+1] > frame {
+			beat.Tempo = 60 / (frameTime(beats.Frames[i+1]) - beat.Time).Seconds()
+		} else if i > 0 {
+			beat.Tempo = result[i-1].Tempo
+		}
+		result = append(result, beat)
+	}
+
+	return result
+}
+
+// Convert Mixxx cues into hot cues and memory cues.
+// Cue positions are stored as sample offsets, with two samples per frame.
+func CuesFromMixxx(cues []mixxx.Cue, sampleRate int64) []library.Cue {
+	if sampleRate == 0 {
+		return nil
+	}
+
+	sampleTime := func(samples int64) time.Duration {
+		return time.Duration(float64(samples) / 2 / float64(sampleRate) * float64(time.Second))
+	}
+
+	result := make([]library.Cue, 0, len(cues))
+	for _, cue := range cues {
+		if cue.Position < 0 {
+			continue
+		}
+		c := library.Cue{
+			HotCue: mixxx.NoHotCue,
+			Time:   sampleTime(cue.Position),
+			Label:  cue.Label,
+			Color:  uint32(cue.Color) & 0xffffff,
+		}
+		switch cue.Type {
+		case mixxx.CueTypeHotCue:
+			if cue.Hotcue < 0 {
+				continue
+			}
+			c.HotCue = int(cue.Hotcue)
+		case mixxx.CueTypeLoop:
+			if cue.Length <= 0 {
+				continue
+			}
+			c.HotCue = int(cue.Hotcue)
+			c.Length = sampleTime(cue.Length)
+		case mixxx.CueTypeMainCue, mixxx.CueTypeIntro, mixxx.CueTypeOutro:
+		default:
+			continue
+		}
+		result = append(result, c)
+	}
+
+	return result
+}
+
+func pdbCue(cue library.Cue) anlz.Cue {
+	c := anlz.Cue{
+		Type:    anlz.CueTypePoint,
+		Time:    uint32(cue.Time.Milliseconds()),
+		Comment: cue.Label,
+		Red:     uint8(cue.Color >> 16),
+		Green:   uint8(cue.Color >> 8),
+		Blue:    uint8(cue.Color),
+	}
+	if cue.IsHotCue() {
+		c.HotCue = uint32(cue.HotCue + 1)
+	}
+	if cue.IsLoop() {
+		c.Type = anlz.CueTypeLoop
+		c.LoopTime = uint32((cue.Time + cue.Length).Milliseconds())
+	}
+	return c
+}
+
+// Split a track's cues into hot cues and memory cues.
+func PdbCues(t *library.Track) (hotCues, memoryCues []anlz.Cue) {
+	hotCues = make([]anlz.Cue, 0)
+	memoryCues = make([]anlz.Cue, 0)
+	for _, cue := range t.Cues {
+		if cue.IsHotCue() {
+			hotCues = append(hotCues, pdbCue(cue))
+		} else {
+			memoryCues = append(memoryCues, pdbCue(cue))
+		}
+	}
+	return
+}
+
+func PdbBeatGrid(t *library.Track) *anlz.BeatGrid {
+	grid := &anlz.BeatGrid{
+		Beats: make([]anlz.Beat, len(t.Beats)),
+	}
+	for i, beat := range t.Beats {
+		grid.Beats[i] = anlz.Beat{
+			BeatNumber: uint16(i%beatsPerBar + 1),
+			Tempo:      uint16(beat.Tempo * 100),
+			Time:       uint32(beat.Time.Milliseconds()),
+		}
+	}
+	return grid
+}
+
+// Generate the contents of the .DAT and .EXT analysis files for a track.
+// Waveform sections are left out if the waveform is empty.
+func PdbAnalysis(t *library.Track, waveform []library.WaveformSegment, baseDir string) (dat, ext *anlz.File) {
+	pathSection := &anlz.PathSection{
+		Path: MediaPath(t, baseDir),
+	}
+	hotCues, memoryCues := PdbCues(t)
+
+	dat = &anlz.File{
+		Sections: []encoding.BinaryMarshaler{
+			pathSection,
+			PdbBeatGrid(t),
+		},
+	}
+
+	ext = &anlz.File{
+		Sections: []encoding.BinaryMarshaler{
+			pathSection,
+		},
+	}
+
+	if len(waveform) > 0 {
+		dat.Sections = append(dat.Sections,
+			PdbWaveformPreview(waveform),
+			PdbTinyWaveformPreview(waveform),
+		)
+		ext.Sections = append(ext.Sections,
+			PdbWaveformDetail(waveform),
+			PdbColorWaveformPreview(waveform),
+			PdbColorWaveformDetail(waveform),
+		)
+	}
+
+	dat.Sections = append(dat.Sections,
+		&anlz.CueList{Type: anlz.CueListMemory, Cues: memoryCues},
+		&anlz.CueList{Type: anlz.CueListHotCues, Cues: hotCues},
+	)
+	ext.Sections = append(ext.Sections,
+		&anlz.ExtendedCueList{Type: anlz.CueListMemory, Cues: memoryCues},
+		&anlz.ExtendedCueList{Type: anlz.CueListHotCues, Cues: hotCues},
+	)
+
+	return
+}
+
+// Write analysis files for a track to the location referenced by its track row.
+// The waveform is not kept on the track, as it takes up more than a megabyte for each track.
+func WriteAnalysis(lib *library.Library, t *library.Track, waveform []library.WaveformSegment, baseDir string) error {
+	trackID := uint32(lib.Tracks().ID(t))
+	dat, ext := PdbAnalysis(t, waveform, baseDir)
+
+	files := map[string]*anlz.File{
+		anlz.Path(trackID):    dat,
+		anlz.ExtPath(trackID): ext,
+	}
+
+	for path, file := range files {
+		path = filepath.Join(baseDir, filepath.FromSlash(path))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = marshal.Into(out, file)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		err = out.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package mediascanner
+
+// Extract cover art into the Artwork directory of the export media.
+
+import (
+	`bytes`
+	`context`
+	`crypto/sha1`
+	`fmt`
+	`os`
+	`os/exec`
+	`path/filepath`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mixxx`
+	`github.com/ambientsound/rex/pkg/rekordbox/artwork`
+)
+
+// Returns the file holding the cover art of a Mixxx track,
+// or an empty string if the track has no cover art.
+// Image files are located relative to the directory of the track, unless the path is absolute.
+func CoverArtFromMixxx(track mixxx.ListTracksRow) string {
+	switch track.CoverartType.Int64 {
+	case mixxx.CoverArtTypeMetadata:
+		return track.Path.String
+	case mixxx.CoverArtTypeFile:
+		location := track.CoverartLocation.String
+		if len(location) == 0 || filepath.IsAbs(location) {
+			return location
+		}
+		return filepath.Join(filepath.Dir(track.Path.String), location)
+	default:
+		return ""
+	}
+}
+
+// Read the source image data of a track's cover art.
+// Returns nil if the track has no cover art.
+func ReadCoverArt(ctx context.Context, t *library.Track) ([]byte, error) {
+	switch t.CoverArt {
+	case "":
+		return nil, nil
+	case t.Path:
+		return extractEmbeddedImage(ctx, t.Path)
+	default:
+		return os.ReadFile(t.CoverArt)
+	}
+}
+
+// Copy the attached picture out of an audio file without re-encoding it.
+func extractEmbeddedImage(ctx context.Context, src string) ([]byte, error) {
+	proc := exec.CommandContext(ctx, "ffmpeg",
+		"-i", src,
+		"-an",
+		"-map", "0:v:0",
+		"-codec:v", "copy",
+		"-frames:v", "1",
+		"-f", "image2pipe",
+		"pipe:1",
+	)
+	stderr := &bytes.Buffer{}
+	proc.Stderr = stderr
+	out, err := proc.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w\n%s", err, stderr.String())
+	}
+	return out, nil
+}
+
+// Checksum used to detect tracks sharing the same cover art.
+func ArtworkHash(data []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(data))
+}
+
+// Extract the cover art of a track into the export media, and link the track to it.
+// Images already extracted for other tracks are re-used.
+func ExportArtwork(ctx context.Context, lib *library.Library, t *library.Track, baseDir string) error {
+	data, err := ReadCoverArt(ctx, t)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	hash := ArtworkHash(data)
+	a := lib.Artworks().GetByName(hash)
+	if a != nil {
+		t.Artwork = a
+		return nil
+	}
+
+	// The image paths are derived from the ID, but the artwork is only added to the library
+	// once both images are written. Otherwise, the ARTWORK table would point to missing files.
+	id := lib.Artworks().NextID()
+	a = &library.Artwork{
+		Hash: hash,
+		Path: artwork.Path(uint32(id)),
+	}
+	thumbnail := filepath.Join(baseDir, a.Path)
+	medium := filepath.Join(baseDir, artwork.MediumPath(a.Path))
+
+	err = writeArtworkImage(ctx, data, artwork.ThumbnailSize, thumbnail)
+	if err == nil {
+		err = writeArtworkImage(ctx, data, artwork.MediumSize, medium)
+	}
+	if err != nil {
+		os.Remove(thumbnail)
+		os.Remove(medium)
+		return err
+	}
+
+	lib.Artworks().InsertWithID(a, id)
+	t.Artwork = a
+	return nil
+}
+
+// Scale an image to fill a square of the given size, and write it as JPEG.
+// Images that are not square are cropped to the center instead of stretched.
+func writeArtworkImage(ctx context.Context, data []byte, size int, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	proc := exec.CommandContext(ctx, "ffmpeg",
+		"-y",
+		"-i", "pipe:0",
+		"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", size, size, size, size),
+		"-frames:v", "1",
+		"-qscale:v", "2",
+		dst,
+	)
+	proc.Stdin = bytes.NewReader(data)
+	out, err := proc.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, string(out))
+	}
+	return nil
+}
+
+func PdbArtwork(lib *library.Library, a *library.Artwork) artwork.Artwork {
+	return artwork.Artwork{
+		Id:   uint32(lib.Artworks().ID(a)),
+		Path: a.Path,
+	}
+}
+
+// Tracks without cover art are not linked to the ARTWORK table.
+func artworkID(lib *library.Library, a *library.Artwork) uint32 {
+	if a == nil {
+		return 0
+	}
+	return uint32(lib.Artworks().ID(a))
+}
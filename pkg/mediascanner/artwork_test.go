@@ -0,0 +1,69 @@
+package mediascanner_test
+
+import (
+	`context`
+	`database/sql`
+	`os`
+	`path/filepath`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/ambientsound/rex/pkg/mixxx`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestCoverArtFromMixxx(t *testing.T) {
+	track := mixxx.ListTracksRow{
+		Path: sql.NullString{String: "/music/album/track.flac", Valid: true},
+	}
+	assert.Equal(t, "", mediascanner.CoverArtFromMixxx(track))
+
+	track.CoverartType = sql.NullInt64{Int64: mixxx.CoverArtTypeMetadata, Valid: true}
+	assert.Equal(t, "/music/album/track.flac", mediascanner.CoverArtFromMixxx(track))
+
+	track.CoverartType = sql.NullInt64{Int64: mixxx.CoverArtTypeFile, Valid: true}
+	track.CoverartLocation = sql.NullString{String: "cover.jpg", Valid: true}
+	assert.Equal(t, "/music/album/cover.jpg", mediascanner.CoverArtFromMixxx(track))
+
+	track.CoverartLocation = sql.NullString{String: "/pictures/cover.png", Valid: true}
+	assert.Equal(t, "/pictures/cover.png", mediascanner.CoverArtFromMixxx(track))
+}
+
+func TestReadCoverArt(t *testing.T) {
+	ctx := context.Background()
+	cover := filepath.Join(t.TempDir(), "cover.jpg")
+	assert.NoError(t, os.WriteFile(cover, []byte("image data"), 0644))
+
+	data, err := mediascanner.ReadCoverArt(ctx, &library.Track{Path: "/music/track.mp3", CoverArt: cover})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("image data"), data)
+	assert.Equal(t, mediascanner.ArtworkHash([]byte("image data")), mediascanner.ArtworkHash(data))
+	assert.NotEqual(t, mediascanner.ArtworkHash([]byte("other image")), mediascanner.ArtworkHash(data))
+
+	data, err = mediascanner.ReadCoverArt(ctx, &library.Track{Path: "/music/track.mp3"})
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+// Artwork that can not be converted to JPEG is not added to the library,
+// so no ARTWORK row points to missing images, and no partial images are left behind.
+func TestExportArtwork_Failure(t *testing.T) {
+	ctx := context.Background()
+	baseDir := t.TempDir()
+	cover := filepath.Join(t.TempDir(), "cover.jpg")
+	assert.NoError(t, os.WriteFile(cover, []byte("not an image"), 0644))
+
+	lib := library.New()
+	for _, path := range []string{"/music/a.mp3", "/music/b.mp3"} {
+		tr := &library.Track{Path: path, CoverArt: cover}
+		assert.Error(t, mediascanner.ExportArtwork(ctx, lib, tr, baseDir))
+		assert.Nil(t, tr.Artwork)
+	}
+	assert.Empty(t, lib.Artworks().All())
+	assert.Equal(t, library.ID(1), lib.Artworks().NextID())
+
+	images, err := filepath.Glob(filepath.Join(baseDir, "PIONEER", "Artwork", "*", "*"))
+	assert.NoError(t, err)
+	assert.Empty(t, images)
+}
@@ -4,12 +4,14 @@ package mediascanner
 
 import (
 	`context`
+	`crypto/sha1`
 	`encoding/json`
 	`fmt`
 	`io`
 	`os`
 	`os/exec`
 	`path/filepath`
+	`sort`
 	`strconv`
 	`strings`
 	`time`
@@ -17,27 +19,105 @@ import (
 	`github.com/ambientsound/rex/pkg/library`
 	`github.com/ambientsound/rex/pkg/mixxx`
 	`github.com/ambientsound/rex/pkg/rekordbox/album`
+	`github.com/ambientsound/rex/pkg/rekordbox/anlz`
 	`github.com/ambientsound/rex/pkg/rekordbox/artist`
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/ambientsound/rex/pkg/rekordbox/genre`
+	`github.com/ambientsound/rex/pkg/rekordbox/key`
+	`github.com/ambientsound/rex/pkg/rekordbox/label`
 	`github.com/ambientsound/rex/pkg/rekordbox/track`
 )
 
 type Probe struct {
-	Format struct {
+	Streams []ProbeStream `json:"streams"`
+	Format  struct {
 		Filesize string `json:"size"`
 		Duration string `json:"duration"`
+		Bitrate  string `json:"bit_rate"`
 		Tags     struct {
 			Title       string `json:"title"`
 			Artist      string `json:"artist"`
 			Album       string `json:"album"`
+			AlbumArtist string `json:"album_artist"`
 			Genre       string `json:"genre"`
 			TrackNumber string `json:"track"`
 			Date        string `json:"date"`
+			Composer    string `json:"composer"`
+			Disc        string `json:"disc"`
+			Comment     string `json:"comment"`
+			Isrc        string `json:"isrc"`
+			IsrcTSRC    string `json:"TSRC"`
+			Bpm         string `json:"bpm"`
+			BpmTBPM     string `json:"TBPM"`
+
+			// Record labels and remixers are stored under different names,
+			// depending on the file format and tagging software.
+			Publisher      string `json:"publisher"`
+			Label          string `json:"label"`
+			Organization   string `json:"organization"`
+			Remixer        string `json:"remixer"`
+			MixArtist      string `json:"mixartist"`
+			RemixedBy      string `json:"TPE4"`
+			OriginalArtist string `json:"originalartist"`
+			OriginalTPE    string `json:"TOPE"`
 		} `json:"tags"`
 	} `json:"format"`
 }
 
+type ProbeStream struct {
+	CodecType        string `json:"codec_type"`
+	CodecName        string `json:"codec_name"`
+	SampleFormat     string `json:"sample_fmt"`
+	SampleRate       string `json:"sample_rate"`
+	BitsPerSample    int    `json:"bits_per_sample"`
+	BitsPerRawSample string `json:"bits_per_raw_sample"`
+	Channels         int    `json:"channels"`
+	Disposition      struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+}
+
+// Bits per sample of the decoded audio.
+// Lossy formats have no sample depth, but rekordbox writes 16 bits for them anyway.
+func (stream *ProbeStream) SampleDepth() int {
+	if stream.BitsPerSample > 0 {
+		return stream.BitsPerSample
+	}
+	if depth := intOrZero[int](stream.BitsPerRawSample); depth > 0 {
+		return depth
+	}
+	switch stream.SampleFormat {
+	case "u8", "u8p":
+		return 8
+	case "s32", "s32p":
+		return 32
+	default:
+		return 16
+	}
+}
+
+// Returns the first audio stream, or nil if there is none.
+func (probe *Probe) AudioStream() *ProbeStream {
+	for i := range probe.Streams {
+		if probe.Streams[i].CodecType == "audio" {
+			return &probe.Streams[i]
+		}
+	}
+	return nil
+}
+
+// Returns true if the file has cover art, stored as an attached picture stream.
+func (probe *Probe) HasAttachedPicture() bool {
+	for i := range probe.Streams {
+		if probe.Streams[i].CodecType == "video" && probe.Streams[i].Disposition.AttachedPic > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func ProbeMetadata(ctx context.Context, src string) (*Probe, error) {
-	proc := exec.CommandContext(ctx, "ffprobe", "-show_format", "-print_format", "json", src)
+	proc := exec.CommandContext(ctx, "ffprobe", "-show_format", "-show_streams", "-print_format", "json", src)
 	output, err := proc.Output()
 	if err != nil {
 		return nil, err
@@ -51,6 +131,61 @@ func ProbeMetadata(ctx context.Context, src string) (*Probe, error) {
 	return probe, nil
 }
 
+// Returns the first non-empty string.
+func firstOf(values ...string) string {
+	for _, s := range values {
+		if len(s) > 0 {
+			return s
+		}
+	}
+	return ""
+}
+
+// Fill in credits that are missing from the track with tags read by ffprobe.
+func ApplyProbeTags(t *library.Track, probe *Probe) {
+	tags := probe.Format.Tags
+	t.Label = firstOf(t.Label, tags.Publisher, tags.Label, tags.Organization)
+	t.Remixer = firstOf(t.Remixer, tags.Remixer, tags.MixArtist, tags.RemixedBy)
+	t.OriginalArtist = firstOf(t.OriginalArtist, tags.OriginalArtist, tags.OriginalTPE)
+	t.Composer = firstOf(t.Composer, tags.Composer)
+	t.Comment = firstOf(t.Comment, tags.Comment)
+	t.Isrc = firstOf(t.Isrc, tags.Isrc, tags.IsrcTSRC)
+	if t.DiscNumber == 0 {
+		t.DiscNumber = numberOrZero(tags.Disc)
+	}
+}
+
+// Parse track and disc numbers, which may include the total count, e.g. "3/12".
+func numberOrZero(s string) int {
+	number, _, _ := strings.Cut(s, "/")
+	return intOrZero[int](strings.TrimSpace(number))
+}
+
+// Set the file size, bitrate, sample rate and sample depth of a track
+// from a probe of the exported file, as these change when the file is transcoded.
+func ApplyOutputProbe(t *library.Track, probe *Probe) {
+	t.FileSize = intOrZero[int](probe.Format.Filesize)
+	t.Bitrate = intOrZero[int](probe.Format.Bitrate) / 1000
+	stream := probe.AudioStream()
+	if stream == nil {
+		return
+	}
+	t.SampleRate = float64(intOrZero[int](stream.SampleRate))
+	t.SampleDepth = stream.SampleDepth()
+}
+
+// Set the codec, sample rate and sample depth of a track from a probe of its source file.
+// The target decides from these whether the file can be copied as it is.
+func ApplySourceProbe(t *library.Track, probe *Probe) {
+	stream := probe.AudioStream()
+	if stream == nil {
+		return
+	}
+	t.Codec = stream.CodecName
+	t.SampleRate = float64(intOrZero[int](stream.SampleRate))
+	t.SampleDepth = stream.SampleDepth()
+}
+
 func intOrZero[T int | uint16 | uint32](s string) T {
 	i, err := strconv.Atoi(s)
 	if err != nil {
@@ -85,8 +220,14 @@ func yearOrZero(tm *time.Time) uint16 {
 	return uint16(tm.Year())
 }
 
-func TrackFromMixxx(track mixxx.ListTracksRow) *library.Track {
+func TrackFromMixxx(track mixxx.ListTracksRow, keyNotation mixxx.KeyNotation) *library.Track {
 	trackNumber, _ := strconv.Atoi(track.Tracknumber.String)
+	keyID := track.KeyID.Int64
+	if keyID == 0 {
+		// Key ID not set; parse the text representation, so that all keys are written in the same notation.
+		keyID = mixxx.ParseKey(track.Key.String)
+	}
+	key := mixxx.KeyName(keyID, keyNotation)
 	return &library.Track{
 		Path:        track.Path.String,
 		Title:       track.Title.String,
@@ -97,31 +238,102 @@ func TrackFromMixxx(track mixxx.ListTracksRow) *library.Track {
 		Tempo:       track.Bpm.Float64,
 		FileType:    track.Filetype.String,
 		AddedDate:   detectDate(track.DatetimeAdded.String),
-		Duration:    time.Duration(track.Duration.Float64),
+		Duration:    time.Duration(track.Duration.Float64 * float64(time.Second)),
 		Artist:      track.Artist.String,
 		Album:       track.Album.String,
-		// SampleDepth
-		// DiscNumber
+		AlbumArtist: track.AlbumArtist.String,
+		Genre:       track.Genre.String,
+		Key:         key,
+		Composer:    track.Composer.String,
+		Comment:     track.Comment.String,
+		// Mixxx has no record label field, so the grouping field is commonly used instead.
+		Label:    track.Grouping.String,
+		Beats:    beatsFromMixxx(track),
+		CoverArt: CoverArtFromMixxx(track),
+		Color:    colorFromMixxx(track),
+		Rating:   int(track.Rating.Int64),
+		// Sample depth, disc number and ISRC are read from the file tags,
+		// see ApplyProbeTags and ApplyOutputProbe.
 		// ReleaseDate
-		// Isrc
 	}
 }
 
+// Tracks without a color have NULL in the `color` column.
+func colorFromMixxx(track mixxx.ListTracksRow) *uint32 {
+	if !track.Color.Valid {
+		return nil
+	}
+	rgb := uint32(track.Color.Int64) & 0xffffff
+	return &rgb
+}
+
 type RenderResult struct {
 	Action string
 }
 
-func RenderTo(ctx context.Context, t *library.Track, outputDir string) (*RenderResult, error) {
-	{
-		filename := filepath.Base(t.Path)
-		outputPath := filepath.Join(outputDir, filename)
+// Names of the rendered files relative to the output directory, keyed by source path.
+// Files inside sourceDir keep their path relative to it, so that files with the same name
+// in different directories do not overwrite each other. Other files are named after the source file.
+//
+// Files that would still get the same name, e.g. tracks from different albums in a Mixxx library,
+// get a short hash of their source path added to it, so that every run gives them the same names.
+// USB media is usually formatted with FAT32, where file names are case insensitive,
+// so names that differ only in case are considered equal.
+func OutputNames(paths []string, sourceDir string) map[string]string {
+	paths = append([]string{}, paths...)
+	sort.Strings(paths)
 
-		if t.FileType != "mp3" {
-			outputPath += ".mp3"
+	names := make(map[string]string, len(paths))
+	count := make(map[string]int)
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if len(sourceDir) > 0 {
+			rel, err := filepath.Rel(sourceDir, path)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				name = rel
+			}
 		}
-		t.OutputPath = outputPath
+		names[path] = name
+		count[strings.ToLower(name)]++
 	}
 
+	taken := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if count[strings.ToLower(names[path])] == 1 {
+			taken[strings.ToLower(names[path])] = true
+		}
+	}
+	for _, path := range paths {
+		name := names[path]
+		if count[strings.ToLower(name)] == 1 {
+			continue
+		}
+		sum := sha1.Sum([]byte(path))
+		ext := filepath.Ext(name)
+		base := fmt.Sprintf("%s-%x", strings.TrimSuffix(name, ext), sum[:4])
+		name = base + ext
+		for i := 2; taken[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		taken[strings.ToLower(name)] = true
+		names[path] = name
+	}
+	return names
+}
+
+// Path of the rendered file in the output directory, given its name from OutputNames.
+// Files that the target can not play get the extension of the transcoded file.
+func OutputPath(t *library.Track, outputDir, name string, target *Target, profile *TranscodeProfile) string {
+	outputPath := filepath.Join(outputDir, name)
+
+	if !target.Plays(t) {
+		outputPath += "." + profile.Extension
+	}
+	return outputPath
+}
+
+// Copy a track to its output path if the target can play it, otherwise transcode it.
+func RenderTo(ctx context.Context, t *library.Track, target *Target, profile *TranscodeProfile) (*RenderResult, error) {
 	_, err := os.Stat(t.OutputPath)
 	if err == nil {
 		return &RenderResult{Action: "skip"}, nil
@@ -129,33 +341,28 @@ func RenderTo(ctx context.Context, t *library.Track, outputDir string) (*RenderR
 		return nil, err
 	}
 
-	switch t.FileType {
-	case "mp3":
-		err = CopyFile(t.Path, t.OutputPath)
+	err = os.MkdirAll(filepath.Dir(t.OutputPath), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Plays(t) {
+		err = CopyFile(ctx, t.Path, t.OutputPath)
 		return &RenderResult{Action: "copy"}, err
-	default:
-		err = ConvertToMP3(ctx, t.Path, t.OutputPath)
-		return &RenderResult{Action: "encode"}, err
 	}
-}
 
-func ConvertToMP3(ctx context.Context, src, dst string) error {
-	proc := exec.CommandContext(ctx, "ffmpeg",
-		"-i", src,
-		"-map_metadata", "0",
-		"-codec:a", "libmp3lame",
-		"-qscale:a", "0",
-		"-joint_stereo", "0",
-		dst,
-	)
-	out, err := proc.CombinedOutput()
+	// Partially written files are removed, so that they are not skipped on the next run.
+	err = Transcode(ctx, t.Path, t.OutputPath, target.ProfileFor(t, profile))
 	if err != nil {
-		return fmt.Errorf("%w\n%s", err, string(out))
+		os.Remove(t.OutputPath)
 	}
-	return nil
+	return &RenderResult{Action: "encode"}, err
 }
 
-func CopyFile(inputPath, outputPath string) error {
+// Copy a file, stopping when the context is cancelled.
+// Large uncompressed files take a while to copy, so the context is checked between each chunk.
+// The output file is removed if the copy fails or is interrupted.
+func CopyFile(ctx context.Context, inputPath, outputPath string) error {
 	in, err := os.Open(inputPath)
 	if err != nil {
 		return err
@@ -166,68 +373,137 @@ func CopyFile(inputPath, outputPath string) error {
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, in)
+	_, err = io.Copy(out, &contextReader{ctx: ctx, r: in})
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
 
 	if err != nil {
-		os.Remove(out.Name())
+		os.Remove(outputPath)
 	}
 
 	return err
 }
 
+// Returns the context's error instead of reading, once the context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
 func TrackFromFile(lib *library.Library, path string, probe Probe) *library.Track {
 	now := time.Now()
-	return &library.Track{
+	t := &library.Track{
 		Path:        path,
-		Bitrate:     320,   // FIXME
-		Tempo:       128,   // FIXME
-		SampleDepth: 16,    // FIXME
-		SampleRate:  44100, // FIXME
-		DiscNumber:  0,     // FIXME
-		Isrc:        "",    // FIXME
-		FileSize:    intOrZero[int](probe.Format.Filesize),
-		TrackNumber: intOrZero[int](probe.Format.Tags.TrackNumber),
+		FileType:    strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."),
+		Tempo:       floatOrZero(firstOf(probe.Format.Tags.Bpm, probe.Format.Tags.BpmTBPM)),
+		TrackNumber: numberOrZero(probe.Format.Tags.TrackNumber),
 		ReleaseDate: detectDate(probe.Format.Tags.Date),
 		AddedDate:   &now,
 		Artist:      probe.Format.Tags.Artist,
 		Album:       probe.Format.Tags.Album,
+		AlbumArtist: probe.Format.Tags.AlbumArtist,
+		Genre:       probe.Format.Tags.Genre,
 		Duration:    parseDuration(probe.Format.Duration),
 		Title:       probe.Format.Tags.Title,
 	}
+	ApplyOutputProbe(t, &probe)
+	ApplySourceProbe(t, &probe)
+	ApplyProbeTags(t, &probe)
+	if probe.HasAttachedPicture() {
+		t.CoverArt = path
+	}
+	// Untagged files are named after the file.
+	if len(t.Title) == 0 {
+		t.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return t
 }
 
-func PdbTrack(lib *library.Library, t *library.Track, baseDir string) track.Track {
-	const isoDateFormat = "2006-01-02"
+func floatOrZero(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// Path of the exported file, relative to the root of the export media.
+func MediaPath(t *library.Track, baseDir string) string {
 	baseDir = strings.TrimRight(baseDir, "/")
 	filePath := t.OutputPath
 	if strings.HasPrefix(filePath, baseDir) {
 		filePath = filePath[len(baseDir):]
 	}
+	return filePath
+}
+
+// Track colors are converted to color IDs using the given mapping.
+func PdbTrack(lib *library.Library, t *library.Track, baseDir string, colors color.Mapping) track.Track {
+	const isoDateFormat = "2006-01-02"
+	filePath := MediaPath(t, baseDir)
 
 	return track.Track{
 		Header: track.Header{
-			FileSize:    uint32(t.FileSize),
-			TrackNumber: uint32(t.TrackNumber),
-			Year:        yearOrZero(t.ReleaseDate),
-			Duration:    uint16(t.Duration.Seconds()),
-			Bitrate:     uint32(t.Bitrate),
-			Tempo:       uint32(t.Tempo * 100),
-			Id:          uint32(lib.Tracks().ID(t)),
-			ArtistId:    uint32(lib.Artists().ID(lib.Artist(t.Artist))),
-			AlbumId:     uint32(lib.Albums().ID(lib.Album(t.Album))),
-			SampleDepth: uint16(t.SampleDepth),
-			SampleRate:  uint32(t.SampleRate),
-			FileType:    track.FileTypeMP3,
+			FileSize:         uint32(t.FileSize),
+			TrackNumber:      uint32(t.TrackNumber),
+			Year:             yearOrZero(t.ReleaseDate),
+			Duration:         uint16(t.Duration.Seconds()),
+			Bitrate:          uint32(t.Bitrate),
+			Tempo:            uint32(t.Tempo * 100),
+			Id:               uint32(lib.Tracks().ID(t)),
+			ArtistId:         uint32(lib.Artists().ID(lib.Artist(t.Artist))),
+			AlbumId:          albumID(lib, t.Album, t.AlbumArtist),
+			GenreId:          genreID(lib, t.Genre),
+			KeyId:            keyID(lib, t.Key),
+			LabelId:          labelID(lib, t.Label),
+			RemixerId:        artistID(lib, t.Remixer),
+			OriginalArtistId: artistID(lib, t.OriginalArtist),
+			ComposerId:       artistID(lib, t.Composer),
+			ArtworkId:        artworkID(lib, t.Artwork),
+			ColorId:          colorID(t.Color, colors),
+			Rating:           uint8(t.Rating),
+			SampleDepth:      uint16(t.SampleDepth),
+			SampleRate:       uint32(t.SampleRate),
+			DiscNumber:       uint16(t.DiscNumber),
+			FileType:         outputFileType(t),
 		},
-		AnalyzeDate: time.Now().Format(isoDateFormat),
-		FilePath:    filePath,
-		DateAdded:   t.AddedDate.Format(isoDateFormat),
-		Filename:    filepath.Base(t.Path),
-		Title:       t.Title,
-		// AnalyzePath: "/PIONEER/USBANLZ/P016/0000875E/ANLZ0000.DAT",
+		Isrc:            t.Isrc,
+		Comment:         t.Comment,
+		AnalyzeDate:     time.Now().Format(isoDateFormat),
+		FilePath:        filePath,
+		DateAdded:       t.AddedDate.Format(isoDateFormat),
+		Filename:        filepath.Base(t.Path),
+		Title:           t.Title,
+		Composer:        t.Composer,
+		AnalyzePath:     anlz.Path(uint32(lib.Tracks().ID(t))),
+		AutoloadHotcues: autoloadHotcues(t),
+	}
+}
+
+// Tracks without a color are not linked to the COLORS table.
+func colorID(rgb *uint32, colors color.Mapping) uint8 {
+	if rgb == nil {
+		return 0
+	}
+	return uint8(colors.ID(*rgb))
+}
+
+// Hot cues are loaded automatically only for tracks that have cues.
+func autoloadHotcues(t *library.Track) string {
+	if len(t.Cues) == 0 {
+		return ""
 	}
+	return "ON"
 }
 
 func PdbArtist(lib *library.Library, a *library.Artist) artist.Artist {
@@ -237,24 +513,105 @@ func PdbArtist(lib *library.Library, a *library.Artist) artist.Artist {
 	}
 }
 
+// Remixers, original artists and composers are linked to the ARTISTS table,
+// unless the name is empty.
+func artistID(lib *library.Library, name string) uint32 {
+	if len(name) == 0 {
+		return 0
+	}
+	return uint32(lib.Artists().ID(lib.Artist(name)))
+}
+
 func PdbAlbum(lib *library.Library, a *library.Album) album.Album {
+	var artistID uint32
+	if a.Artist != nil {
+		artistID = uint32(lib.Artists().ID(a.Artist))
+	}
 	return album.Album{
 		Id:       uint32(lib.Albums().ID(a)),
-		ArtistId: 0, // FIXME: multiple artist albums with ID 0, otherwise get ref?
+		ArtistId: artistID,
 		Name:     a.Title,
 	}
 }
 
+// Tracks without an album title are not linked to the ALBUMS table.
+// Albums are identified by both title and album artist, see library.ResolveAlbumArtists.
+func albumID(lib *library.Library, title, artist string) uint32 {
+	if len(title) == 0 {
+		return 0
+	}
+	return uint32(lib.Albums().ID(lib.Album(title, artist)))
+}
+
+func PdbGenre(lib *library.Library, g *library.Genre) genre.Genre {
+	return genre.Genre{
+		Id:   uint32(lib.Genres().ID(g)),
+		Name: g.Name,
+	}
+}
+
+// Tracks without a genre are not linked to the GENRES table.
+func genreID(lib *library.Library, name string) uint32 {
+	if len(name) == 0 {
+		return 0
+	}
+	return uint32(lib.Genres().ID(lib.Genre(name)))
+}
+
+func PdbLabel(lib *library.Library, l *library.Label) label.Label {
+	return label.Label{
+		Id:   uint32(lib.Labels().ID(l)),
+		Name: l.Name,
+	}
+}
+
+// Tracks without a record label are not linked to the LABELS table.
+func labelID(lib *library.Library, name string) uint32 {
+	if len(name) == 0 {
+		return 0
+	}
+	return uint32(lib.Labels().ID(lib.Label(name)))
+}
+
+func PdbKey(lib *library.Library, k *library.Key) key.Key {
+	return key.Key{
+		Header: key.Header{
+			Id: uint32(lib.Keys().ID(k)),
+		},
+		Name: k.Name,
+	}
+}
+
+// Tracks without a detected key are not linked to the KEYS table.
+func keyID(lib *library.Library, name string) uint32 {
+	if len(name) == 0 {
+		return 0
+	}
+	return uint32(lib.Keys().ID(lib.Key(name)))
+}
+
+// File type of the exported file, detected from its extension.
+func outputFileType(t *library.Track) track.FileType {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(t.OutputPath)), ".")
+	fileType, err := FileTypeFromString(ext)
+	if err != nil {
+		return track.FileTypeMP3
+	}
+	return fileType
+}
+
 func FileTypeFromString(t string) (track.FileType, error) {
 	switch t {
 	case "mp3":
 		return track.FileTypeMP3, nil
-	case "aac":
+	case "aac", "m4a", "mp4":
 		return track.FileTypeM4A, nil
 	case "wav":
 		return track.FileTypeWAV, nil
 	case "flac":
 		return track.FileTypeFLAC, nil
+	case "aif", "aiff":
+		return track.FileTypeAIFF, nil
 	default:
 		return track.FileTypeUnknown, fmt.Errorf("unimplemented file format '%s'", t)
 	}
@@ -0,0 +1,140 @@
+package mediascanner_test
+
+import (
+	`bytes`
+	`context`
+	`encoding/json`
+	`os`
+	`path/filepath`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestApplyProbeTags(t *testing.T) {
+	probe := &mediascanner.Probe{}
+	err := json.Unmarshal([]byte(`{
+		"format": {
+			"tags": {
+				"TITLE": "Windowlicker",
+				"LABEL": "Warp",
+				"MIXARTIST": "Someone Else",
+				"TOPE": "Aphex Twin",
+				"composer": "Richard D. James",
+				"disc": "2/2",
+				"TSRC": "GBBPW9900123",
+				"comment": "Peak time"
+			}
+		}
+	}`), probe)
+	assert.NoError(t, err)
+
+	tr := &library.Track{
+		Composer: "Richard James",
+	}
+	mediascanner.ApplyProbeTags(tr, probe)
+
+	assert.Equal(t, "Warp", tr.Label)
+	assert.Equal(t, "Someone Else", tr.Remixer)
+	assert.Equal(t, "Aphex Twin", tr.OriginalArtist)
+	assert.Equal(t, "Richard James", tr.Composer, "values from the Mixxx library take precedence")
+	assert.Equal(t, 2, tr.DiscNumber)
+	assert.Equal(t, "GBBPW9900123", tr.Isrc)
+	assert.Equal(t, "Peak time", tr.Comment)
+}
+
+func TestTrackFromFile(t *testing.T) {
+	probe := mediascanner.Probe{}
+	err := json.Unmarshal([]byte(`{
+		"streams": [
+			{"codec_type": "audio", "codec_name": "flac", "sample_fmt": "s32", "sample_rate": "96000", "bits_per_sample": 0, "bits_per_raw_sample": "24", "channels": 2}
+		],
+		"format": {
+			"size": "98765432",
+			"duration": "421.5",
+			"bit_rate": "1874000",
+			"tags": {
+				"TITLE": "Xtal",
+				"ARTIST": "Aphex Twin",
+				"TRACK": "1/13",
+				"DISC": "1",
+				"ISRC": "GBBPW9200001",
+				"BPM": "126.5",
+				"DATE": "1992-11-09"
+			}
+		}
+	}`), &probe)
+	assert.NoError(t, err)
+
+	tr := mediascanner.TrackFromFile(library.New(), "/music/xtal.flac", probe)
+
+	assert.Equal(t, "Xtal", tr.Title)
+	assert.Equal(t, "Aphex Twin", tr.Artist)
+	assert.Equal(t, 1, tr.TrackNumber)
+	assert.Equal(t, 1, tr.DiscNumber)
+	assert.Equal(t, "GBBPW9200001", tr.Isrc)
+	assert.Equal(t, 126.5, tr.Tempo)
+	assert.Equal(t, 98765432, tr.FileSize)
+	assert.Equal(t, 1874, tr.Bitrate)
+	assert.Equal(t, 96000.0, tr.SampleRate)
+	assert.Equal(t, 24, tr.SampleDepth)
+	assert.Equal(t, "flac", tr.Codec)
+	assert.Equal(t, 1992, tr.ReleaseDate.Year())
+	assert.Equal(t, "", tr.CoverArt)
+}
+
+// Embedded cover art is read from the audio file itself.
+func TestTrackFromFile_AttachedPicture(t *testing.T) {
+	probe := mediascanner.Probe{}
+	err := json.Unmarshal([]byte(`{
+		"streams": [
+			{"codec_type": "audio", "codec_name": "mp3", "sample_fmt": "fltp", "sample_rate": "44100", "channels": 2, "disposition": {"attached_pic": 0}},
+			{"codec_type": "video", "codec_name": "mjpeg", "disposition": {"attached_pic": 1}}
+		],
+		"format": {}
+	}`), &probe)
+	assert.NoError(t, err)
+
+	tr := mediascanner.TrackFromFile(library.New(), "/music/intro.mp3", probe)
+	assert.Equal(t, "/music/intro.mp3", tr.CoverArt)
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.wav")
+	dst := filepath.Join(dir, "copy.wav")
+	data := bytes.Repeat([]byte("audio data"), 100000)
+	assert.NoError(t, os.WriteFile(src, data, 0644))
+
+	assert.NoError(t, mediascanner.CopyFile(context.Background(), src, dst))
+	copied, err := os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, data, copied)
+}
+
+// An interrupted copy must not leave a partial file behind,
+// as existing files are skipped on the next run.
+func TestCopyFile_Cancel(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.wav")
+	assert.NoError(t, os.WriteFile(src, bytes.Repeat([]byte("audio data"), 100000), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dst := filepath.Join(dir, "copy.wav")
+	assert.ErrorIs(t, mediascanner.CopyFile(ctx, src, dst), context.Canceled)
+	assert.NoFileExists(t, dst)
+
+	outputDir := filepath.Join(dir, "rex")
+	assert.NoError(t, os.Mkdir(outputDir, 0755))
+	tr := &library.Track{Path: src, OutputPath: filepath.Join(outputDir, "a.wav"), FileType: "wav"}
+	target, err := mediascanner.TargetFromString("cdj3000")
+	assert.NoError(t, err)
+	result, err := mediascanner.RenderTo(ctx, tr, target, mediascanner.TranscodeProfiles[mediascanner.DefaultTranscodeProfile])
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "copy", result.Action)
+	assert.NoFileExists(t, tr.OutputPath)
+}
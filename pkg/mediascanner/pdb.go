@@ -0,0 +1,277 @@
+package mediascanner
+
+// Read rekordbox databases back into the internal music library.
+
+import (
+	`path/filepath`
+	`sort`
+	`time`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/rekordbox/album`
+	`github.com/ambientsound/rex/pkg/rekordbox/artist`
+	`github.com/ambientsound/rex/pkg/rekordbox/artwork`
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/genre`
+	`github.com/ambientsound/rex/pkg/rekordbox/history`
+	`github.com/ambientsound/rex/pkg/rekordbox/key`
+	`github.com/ambientsound/rex/pkg/rekordbox/label`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/playlist`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+)
+
+// Build a library from the contents of a rekordbox database.
+// Tracks, artists, albums, genres, keys, labels, artwork and playlists keep their IDs from the database.
+// File paths in the database are relative to baseDir, the root of the export media.
+func LibraryFromPdb(db *dbengine.DbEngine, baseDir string) (*library.Library, error) {
+	lib := library.New()
+
+	artists, err := dbengine.ReadRows[artist.Artist](db, page.Type_Artists)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range artists {
+		lib.Artists().InsertWithID(&library.Artist{Name: row.Name}, library.ID(row.Id))
+	}
+
+	albums, err := dbengine.ReadRows[album.Album](db, page.Type_Albums)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range albums {
+		lib.Albums().InsertWithID(&library.Album{
+			Artist: lib.Artists().GetByID(library.ID(row.ArtistId)),
+			Title:  row.Name,
+		}, library.ID(row.Id))
+	}
+
+	genres, err := dbengine.ReadRows[genre.Genre](db, page.Type_Genres)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range genres {
+		lib.Genres().InsertWithID(&library.Genre{Name: row.Name}, library.ID(row.Id))
+	}
+
+	keys, err := dbengine.ReadRows[key.Key](db, page.Type_Keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range keys {
+		lib.Keys().InsertWithID(&library.Key{Name: row.Name}, library.ID(row.Id))
+	}
+
+	// The image data is not read, so artwork is identified by its path.
+	artworks, err := dbengine.ReadRows[artwork.Artwork](db, page.Type_Artwork)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range artworks {
+		lib.Artworks().InsertWithID(&library.Artwork{Hash: row.Path, Path: row.Path}, library.ID(row.Id))
+	}
+
+	labels, err := dbengine.ReadRows[label.Label](db, page.Type_Labels)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range labels {
+		lib.Labels().InsertWithID(&library.Label{Name: row.Name}, library.ID(row.Id))
+	}
+
+	tracks, err := dbengine.ReadRows[track.Track](db, page.Type_Tracks)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range tracks {
+		lib.Tracks().InsertWithID(TrackFromPdb(lib, row, baseDir), library.ID(row.Id))
+	}
+
+	err = ReadPlaylistTree(db, lib)
+	if err != nil {
+		return nil, err
+	}
+
+	return lib, nil
+}
+
+// Read playlists and folders into the library, keeping their IDs and sort order.
+// Tracks are looked up by ID in the library; playlist entries of tracks not found there are skipped.
+func ReadPlaylistTree(db *dbengine.DbEngine, lib *library.Library) error {
+	rows, err := dbengine.ReadRows[playlist.Playlist](db, page.Type_PlaylistTree)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].SortOrder < rows[j].SortOrder
+	})
+
+	// Parents must be inserted before their children.
+	// Playlists in folders that do not exist are skipped.
+	inserted := make(map[uint32]*library.Playlist)
+	for len(rows) > 0 {
+		remaining := make([]*playlist.Playlist, 0)
+		for _, row := range rows {
+			parent, found := inserted[row.ParentId]
+			if row.ParentId != 0 && !found {
+				remaining = append(remaining, row)
+				continue
+			}
+			pl := &library.Playlist{
+				ID:     library.ID(row.Id),
+				Name:   row.Name,
+				Folder: row.RawIsFolder != 0,
+				Tracks: make([]*library.Track, 0),
+			}
+			lib.InsertPlaylistWithID(parent, pl, library.ID(row.Id))
+			inserted[row.Id] = pl
+		}
+		if len(remaining) == len(rows) {
+			break
+		}
+		rows = remaining
+	}
+
+	entries, err := dbengine.ReadRows[playlist.Entry](db, page.Type_PlaylistEntries)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].EntryIndex < entries[j].EntryIndex
+	})
+	for _, row := range entries {
+		pl := inserted[row.PlaylistID]
+		t := lib.Tracks().GetByID(library.ID(row.TrackID))
+		if pl == nil || t == nil {
+			continue
+		}
+		pl.Tracks = append(pl.Tracks, t)
+	}
+
+	return nil
+}
+
+// Read the history playlists captured by the players, in the order they were played.
+// Tracks are looked up by ID in a library read with LibraryFromPdb.
+func HistoryFromPdb(db *dbengine.DbEngine, lib *library.Library) ([]*library.Playlist, error) {
+	rows, err := dbengine.ReadRows[history.Playlist](db, page.Type_HistoryPlaylists)
+	if err != nil {
+		return nil, err
+	}
+	playlists := make([]*library.Playlist, 0, len(rows))
+	byID := make(map[uint32]*library.Playlist)
+	for _, row := range rows {
+		pl := &library.Playlist{
+			ID:     library.ID(row.Id),
+			Name:   row.Name,
+			Tracks: make([]*library.Track, 0),
+		}
+		playlists = append(playlists, pl)
+		byID[row.Id] = pl
+	}
+
+	entries, err := dbengine.ReadRows[history.Entry](db, page.Type_HistoryEntries)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].EntryIndex < entries[j].EntryIndex
+	})
+	for _, row := range entries {
+		pl := byID[row.PlaylistID]
+		t := lib.Tracks().GetByID(library.ID(row.TrackID))
+		if pl == nil || t == nil {
+			continue
+		}
+		pl.Tracks = append(pl.Tracks, t)
+	}
+
+	return playlists, nil
+}
+
+// Convert a track row to a library track.
+// Artists, albums, genres, keys, labels and artwork are looked up by ID in the library.
+// Track colors are converted to the RGB values of the rekordbox colors.
+func TrackFromPdb(lib *library.Library, t *track.Track, baseDir string) *library.Track {
+	const isoDateFormat = "2006-01-02"
+	filePath := filepath.Join(baseDir, t.FilePath)
+
+	tr := &library.Track{
+		Path:        filePath,
+		OutputPath:  filePath,
+		Title:       t.Title,
+		SampleRate:  float64(t.SampleRate),
+		FileSize:    int(t.FileSize),
+		Bitrate:     int(t.Bitrate),
+		TrackNumber: int(t.TrackNumber),
+		DiscNumber:  int(t.DiscNumber),
+		FileType:    FileTypeToString(t.FileType),
+		Tempo:       float64(t.Tempo) / 100,
+		SampleDepth: int(t.SampleDepth),
+		Duration:    time.Duration(t.Duration) * time.Second,
+		Isrc:        t.Isrc,
+		Comment:     t.Comment,
+		Artwork:     lib.Artworks().GetByID(library.ID(t.ArtworkId)),
+		Rating:      int(t.Rating),
+	}
+
+	if tm, err := time.Parse(isoDateFormat, t.ReleaseDate); err == nil {
+		tr.ReleaseDate = &tm
+	} else if t.Year > 0 {
+		tm := time.Date(int(t.Year), time.January, 1, 0, 0, 0, 0, time.UTC)
+		tr.ReleaseDate = &tm
+	}
+	if tm, err := time.Parse(isoDateFormat, t.DateAdded); err == nil {
+		tr.AddedDate = &tm
+	}
+	if a := lib.Artists().GetByID(library.ID(t.ArtistId)); a != nil {
+		tr.Artist = a.Name
+	}
+	if a := lib.Albums().GetByID(library.ID(t.AlbumId)); a != nil {
+		tr.Album = a.Title
+		if a.Artist != nil {
+			tr.AlbumArtist = a.Artist.Name
+		}
+	}
+	if g := lib.Genres().GetByID(library.ID(t.GenreId)); g != nil {
+		tr.Genre = g.Name
+	}
+	if k := lib.Keys().GetByID(library.ID(t.KeyId)); k != nil {
+		tr.Key = k.Name
+	}
+	if l := lib.Labels().GetByID(library.ID(t.LabelId)); l != nil {
+		tr.Label = l.Name
+	}
+	if a := lib.Artists().GetByID(library.ID(t.RemixerId)); a != nil {
+		tr.Remixer = a.Name
+	}
+	if a := lib.Artists().GetByID(library.ID(t.OriginalArtistId)); a != nil {
+		tr.OriginalArtist = a.Name
+	}
+	if a := lib.Artists().GetByID(library.ID(t.ComposerId)); a != nil {
+		tr.Composer = a.Name
+	}
+	if rgb, found := color.RGB[uint16(t.ColorId)]; found {
+		tr.Color = &rgb
+	}
+
+	return tr
+}
+
+func FileTypeToString(t track.FileType) string {
+	switch t {
+	case track.FileTypeMP3:
+		return "mp3"
+	case track.FileTypeM4A:
+		return "aac"
+	case track.FileTypeWAV:
+		return "wav"
+	case track.FileTypeFLAC:
+		return "flac"
+	case track.FileTypeAIFF:
+		return "aiff"
+	default:
+		return ""
+	}
+}
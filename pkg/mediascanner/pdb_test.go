@@ -0,0 +1,112 @@
+package mediascanner_test
+
+import (
+	`testing`
+	`time`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/ambientsound/rex/pkg/rekordbox/artwork`
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine/dbtest`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/playlist`
+	`github.com/stretchr/testify/assert`
+)
+
+// Test that a library exported to PDB is read back with the same tracks and playlists.
+func TestLibraryFromPdb(t *testing.T) {
+	const baseDir = "/media/usb"
+
+	added := time.Date(2023, time.March, 4, 0, 0, 0, 0, time.UTC)
+	released := time.Date(1998, time.January, 1, 0, 0, 0, 0, time.UTC)
+	lib := library.New()
+	red := uint32(0xff0000)
+	cover := &library.Artwork{Hash: "da39a3ee", Path: artwork.Path(1)}
+	lib.Artworks().Insert(cover)
+	for _, tr := range []*library.Track{
+		{Path: "/music/a.mp3", OutputPath: baseDir + "/rex/a.mp3", Title: "A", Artist: "Artist A", Album: "Album", AlbumArtist: "Artist A", Genre: "House", Key: "Am", Tempo: 124.5, Duration: 301 * time.Second, AddedDate: &added, ReleaseDate: &released, Artwork: cover, Color: &red, Rating: 4, Label: "Warp", Remixer: "Artist B", Composer: "Someone", Comment: "Peak time", DiscNumber: 2, Isrc: "GBBPW9900123"},
+		{Path: "/music/b.mp3", OutputPath: baseDir + "/rex/b.mp3", Title: "B", Artist: "Artist B", Album: "Album", AddedDate: &added},
+	} {
+		lib.InsertTrack(tr)
+	}
+	lib.Playlists().Insert(&library.Playlist{
+		Name:   "Friday",
+		Tracks: []*library.Track{lib.Tracks().GetByID(2), lib.Tracks().GetByID(1)},
+	})
+
+	db := dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for _, tr := range lib.Tracks().All() {
+			row := mediascanner.PdbTrack(lib, tr, baseDir, nil)
+			assert.NoError(t, db.InsertRow(page.Type_Tracks, &row))
+		}
+		for _, a := range lib.Artists().All() {
+			row := mediascanner.PdbArtist(lib, a)
+			assert.NoError(t, db.InsertRow(page.Type_Artists, &row))
+		}
+		for _, a := range lib.Albums().All() {
+			row := mediascanner.PdbAlbum(lib, a)
+			assert.NoError(t, db.InsertRow(page.Type_Albums, &row))
+		}
+		for _, g := range lib.Genres().All() {
+			row := mediascanner.PdbGenre(lib, g)
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &row))
+		}
+		for _, k := range lib.Keys().All() {
+			row := mediascanner.PdbKey(lib, k)
+			assert.NoError(t, db.InsertRow(page.Type_Keys, &row))
+		}
+		for _, l := range lib.Labels().All() {
+			row := mediascanner.PdbLabel(lib, l)
+			assert.NoError(t, db.InsertRow(page.Type_Labels, &row))
+		}
+		for _, a := range lib.Artworks().All() {
+			row := mediascanner.PdbArtwork(lib, a)
+			assert.NoError(t, db.InsertRow(page.Type_Artwork, &row))
+		}
+		assert.NoError(t, db.InsertRow(page.Type_PlaylistTree, &playlist.Playlist{
+			PlaylistHeader: playlist.PlaylistHeader{Id: 1},
+			Name:           "Friday",
+		}))
+		assert.NoError(t, db.InsertRow(page.Type_PlaylistEntries, &playlist.Entry{EntryIndex: 2, TrackID: 1, PlaylistID: 1}))
+		assert.NoError(t, db.InsertRow(page.Type_PlaylistEntries, &playlist.Entry{EntryIndex: 1, TrackID: 2, PlaylistID: 1}))
+	})
+	imported, err := mediascanner.LibraryFromPdb(db, baseDir)
+	assert.NoError(t, err)
+
+	assert.Len(t, imported.Tracks().All(), 2)
+	a := imported.Tracks().GetByID(1)
+	assert.Equal(t, baseDir+"/rex/a.mp3", a.Path)
+	assert.Equal(t, "A", a.Title)
+	assert.Equal(t, "Artist A", a.Artist)
+	assert.Equal(t, "Album", a.Album)
+	assert.Equal(t, "Artist A", a.AlbumArtist)
+	assert.Equal(t, "", imported.Tracks().GetByID(2).AlbumArtist)
+	assert.Len(t, imported.Albums().All(), 2)
+	assert.Equal(t, "House", a.Genre)
+	assert.Equal(t, "Am", a.Key)
+	assert.Equal(t, "mp3", a.FileType)
+	assert.Equal(t, 124.5, a.Tempo)
+	assert.Equal(t, 301*time.Second, a.Duration)
+	assert.Equal(t, added, *a.AddedDate)
+	assert.Equal(t, released, *a.ReleaseDate)
+	assert.Equal(t, "/PIONEER/Artwork/00001/a1.jpg", a.Artwork.Path)
+	assert.Equal(t, color.RGB[2], *a.Color)
+	assert.Equal(t, 4, a.Rating)
+	assert.Equal(t, "Warp", a.Label)
+	assert.Equal(t, "Artist B", a.Remixer)
+	assert.Equal(t, "Someone", a.Composer)
+	assert.Equal(t, "Peak time", a.Comment)
+	assert.Equal(t, 2, a.DiscNumber)
+	assert.Equal(t, "GBBPW9900123", a.Isrc)
+	assert.Equal(t, "", a.OriginalArtist)
+	assert.Equal(t, "", imported.Tracks().GetByID(2).Genre)
+	assert.Nil(t, imported.Tracks().GetByID(2).Artwork)
+	assert.Nil(t, imported.Tracks().GetByID(2).Color)
+
+	playlists := imported.Playlists().All()
+	assert.Len(t, playlists, 1)
+	assert.Equal(t, "Friday", playlists[0].Name)
+	assert.Equal(t, []*library.Track{imported.Tracks().GetByID(2), a}, playlists[0].Tracks)
+}
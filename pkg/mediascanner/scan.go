@@ -0,0 +1,91 @@
+package mediascanner
+
+// Find audio files and playlists in a directory tree.
+
+import (
+	`bufio`
+	`io/fs`
+	`os`
+	`path/filepath`
+	`strings`
+)
+
+// File extensions of audio files picked up when scanning directories.
+var AudioExtensions = []string{".mp3", ".m4a", ".aac", ".mp4", ".flac", ".wav", ".aif", ".aiff", ".ogg", ".opus"}
+
+// File extensions of M3U playlists.
+var PlaylistExtensions = []string{".m3u", ".m3u8"}
+
+// Audio files and playlists found in a directory tree.
+type ScanResult struct {
+	Files     []string // Audio files, in lexical order.
+	Playlists []string // M3U playlists, in lexical order.
+}
+
+func hasExtension(path string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk a directory tree, collecting audio files and playlists.
+// Hidden files and directories are skipped.
+func ScanDir(root string) (*ScanResult, error) {
+	result := &ScanResult{
+		Files:     make([]string, 0),
+		Playlists: make([]string, 0),
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch {
+		case hasExtension(path, AudioExtensions):
+			result.Files = append(result.Files, path)
+		case hasExtension(path, PlaylistExtensions):
+			result.Playlists = append(result.Playlists, path)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Read the file paths in an M3U playlist.
+// Relative paths are resolved against the directory of the playlist.
+func ReadM3U(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	files := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF"))
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "file://")
+		line = filepath.FromSlash(strings.ReplaceAll(line, `\`, "/"))
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		files = append(files, filepath.Clean(line))
+	}
+	return files, scanner.Err()
+}
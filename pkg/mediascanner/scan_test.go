@@ -0,0 +1,51 @@
+package mediascanner_test
+
+import (
+	`os`
+	`path/filepath`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestScanDir(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{
+		"House/Deep/a.mp3",
+		"House/b.FLAC",
+		"House/cover.jpg",
+		"Techno/c.wav",
+		".hidden/d.mp3",
+		"Techno/.e.mp3",
+		"sets/friday.m3u8",
+	} {
+		path = filepath.Join(root, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+
+	result, err := mediascanner.ScanDir(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(root, "House/Deep/a.mp3"),
+		filepath.Join(root, "House/b.FLAC"),
+		filepath.Join(root, "Techno/c.wav"),
+	}, result.Files)
+	assert.Equal(t, []string{filepath.Join(root, "sets/friday.m3u8")}, result.Playlists)
+}
+
+func TestReadM3U(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "friday.m3u")
+	err := os.WriteFile(path, []byte("#EXTM3U\n#EXTINF:301,Artist - Title\n../House/a.mp3\n\n/music/b.flac\r\nfile:///music/c.wav\n"), 0644)
+	assert.NoError(t, err)
+
+	files, err := mediascanner.ReadM3U(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(filepath.Dir(dir), "House/a.mp3"),
+		"/music/b.flac",
+		"/music/c.wav",
+	}, files)
+}
@@ -0,0 +1,153 @@
+package mediascanner
+
+// Audio formats supported by the players that an export is made for.
+
+import (
+	`fmt`
+	`sort`
+	`strings`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+)
+
+// A player model, or a group of models, and the audio formats it can play.
+type Target struct {
+	Name           string
+	FileTypes      []track.FileType
+	Codecs         []string // Audio codecs as named by FFMPEG. Uncompressed audio of any kind is "pcm".
+	MaxSampleRate  int      // Hz.
+	MaxSampleDepth int      // Bits per sample, only checked for uncompressed and lossless audio.
+}
+
+// Name of the target used when none is given; MP3 files play on every player.
+const DefaultTarget = "generic"
+
+var Targets = map[string]*Target{
+	DefaultTarget: {
+		Name:           DefaultTarget,
+		FileTypes:      []track.FileType{track.FileTypeMP3},
+		Codecs:         []string{"mp3"},
+		MaxSampleRate:  48000,
+		MaxSampleDepth: 16,
+	},
+	"cdj2000": {
+		Name:           "cdj2000",
+		FileTypes:      []track.FileType{track.FileTypeMP3, track.FileTypeM4A, track.FileTypeWAV, track.FileTypeAIFF},
+		Codecs:         []string{"mp3", "aac", "pcm"},
+		MaxSampleRate:  48000,
+		MaxSampleDepth: 24,
+	},
+	"xdj-rx": {
+		Name:           "xdj-rx",
+		FileTypes:      []track.FileType{track.FileTypeMP3, track.FileTypeM4A, track.FileTypeWAV, track.FileTypeAIFF},
+		Codecs:         []string{"mp3", "aac", "pcm"},
+		MaxSampleRate:  48000,
+		MaxSampleDepth: 24,
+	},
+	"cdj2000nxs2": {
+		Name:           "cdj2000nxs2",
+		FileTypes:      []track.FileType{track.FileTypeMP3, track.FileTypeM4A, track.FileTypeWAV, track.FileTypeAIFF, track.FileTypeFLAC},
+		Codecs:         []string{"mp3", "aac", "alac", "pcm", "flac"},
+		MaxSampleRate:  96000,
+		MaxSampleDepth: 24,
+	},
+	"cdj3000": {
+		Name:           "cdj3000",
+		FileTypes:      []track.FileType{track.FileTypeMP3, track.FileTypeM4A, track.FileTypeWAV, track.FileTypeAIFF, track.FileTypeFLAC},
+		Codecs:         []string{"mp3", "aac", "alac", "pcm", "flac"},
+		MaxSampleRate:  96000,
+		MaxSampleDepth: 24,
+	},
+}
+
+func TargetFromString(name string) (*Target, error) {
+	target, found := Targets[strings.ToLower(name)]
+	if !found {
+		return nil, fmt.Errorf("unknown target '%s', expected one of: %s", name, strings.Join(TargetNames(), ", "))
+	}
+	return target, nil
+}
+
+// Names of all targets, in alphabetical order.
+func TargetNames() []string {
+	names := make([]string, 0, len(Targets))
+	for name := range Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns true if the target can play files of the given type.
+func (target *Target) Supports(fileType track.FileType) bool {
+	for _, ft := range target.FileTypes {
+		if ft == fileType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the target can play files encoded with the profile.
+// Profiles that keep the sample rate of the source file are capped by ProfileFor.
+func (target *Target) SupportsProfile(profile *TranscodeProfile) bool {
+	fileType, err := FileTypeFromString(strings.ToLower(profile.Extension))
+	if err != nil {
+		return false
+	}
+	return target.Supports(fileType) && profile.SampleRate <= target.MaxSampleRate
+}
+
+// Returns the profile to transcode a track with.
+// Profiles without a sample rate keep the sample rate of the source file, unless it is
+// higher than the target plays, or unknown; those files are resampled to the highest rate the target plays.
+func (target *Target) ProfileFor(t *library.Track, profile *TranscodeProfile) *TranscodeProfile {
+	if profile.SampleRate > 0 || (t.SampleRate > 0 && int(t.SampleRate) <= target.MaxSampleRate) {
+		return profile
+	}
+	capped := *profile
+	capped.SampleRate = target.MaxSampleRate
+	return &capped
+}
+
+// Returns true if the target can play the track's source file as it is.
+// The codec, sample rate and sample depth of the audio stream must be supported, as well as the file type;
+// e.g. ALAC in M4A files, or WAV files at 96 kHz, do not play on older players.
+// Tracks that have not been probed yet are judged by their file type alone.
+func (target *Target) Plays(t *library.Track) bool {
+	fileType, err := FileTypeFromString(strings.ToLower(t.FileType))
+	if err != nil || !target.Supports(fileType) {
+		return false
+	}
+	if len(t.Codec) == 0 {
+		return true
+	}
+	codec := codecFamily(t.Codec)
+	if !target.supportsCodec(codec) || int(t.SampleRate) > target.MaxSampleRate {
+		return false
+	}
+	switch codec {
+	case "pcm", "flac", "alac":
+		return t.SampleDepth <= target.MaxSampleDepth
+	default:
+		return true
+	}
+}
+
+func (target *Target) supportsCodec(codec string) bool {
+	for _, c := range target.Codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// FFMPEG names uncompressed audio by its sample format, e.g. "pcm_s24le".
+func codecFamily(codec string) string {
+	if strings.HasPrefix(codec, "pcm_") {
+		return "pcm"
+	}
+	return codec
+}
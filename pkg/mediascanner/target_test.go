@@ -0,0 +1,137 @@
+package mediascanner_test
+
+import (
+	`strings`
+	`testing`
+	`time`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestTarget(t *testing.T) {
+	flac := &library.Track{Path: "/music/a.flac", FileType: "flac"}
+	aiff := &library.Track{Path: "/music/b.aif", FileType: "aiff"}
+	ogg := &library.Track{Path: "/music/c.ogg", FileType: "ogg"}
+	mp3 := mediascanner.TranscodeProfiles[mediascanner.DefaultTranscodeProfile]
+
+	generic, err := mediascanner.TargetFromString(mediascanner.DefaultTarget)
+	assert.NoError(t, err)
+	assert.False(t, generic.Plays(flac))
+	assert.True(t, generic.SupportsProfile(mp3))
+	assert.False(t, generic.SupportsProfile(mediascanner.TranscodeProfiles["wav"]))
+	assert.Equal(t, "/usb/rex/a.flac.mp3", mediascanner.OutputPath(flac, "/usb/rex", "a.flac", generic, mp3))
+
+	rx, err := mediascanner.TargetFromString("XDJ-RX")
+	assert.NoError(t, err)
+	assert.False(t, rx.Plays(flac))
+	assert.True(t, rx.Plays(aiff))
+	assert.False(t, rx.Plays(ogg))
+
+	cdj, err := mediascanner.TargetFromString("cdj3000")
+	assert.NoError(t, err)
+	assert.True(t, cdj.Plays(flac))
+	assert.True(t, cdj.Supports(track.FileTypeM4A))
+	assert.Equal(t, "/usb/rex/a.flac", mediascanner.OutputPath(flac, "/usb/rex", "a.flac", cdj, mp3))
+	assert.Equal(t, "/usb/rex/c.ogg.mp3", mediascanner.OutputPath(ogg, "/usb/rex", "c.ogg", cdj, mp3))
+	assert.Equal(t, "/usb/rex/c.ogg.aiff", mediascanner.OutputPath(ogg, "/usb/rex", "c.ogg", cdj, mediascanner.TranscodeProfiles["aiff"]))
+
+	// Files are copied only if the player can decode the audio stream inside them.
+	alac := &library.Track{Path: "/music/d.m4a", FileType: "m4a", Codec: "alac", SampleRate: 44100, SampleDepth: 16}
+	hires := &library.Track{Path: "/music/e.wav", FileType: "wav", Codec: "pcm_s24le", SampleRate: 96000, SampleDepth: 24}
+	wav24 := &library.Track{Path: "/music/f.aiff", FileType: "aiff", Codec: "pcm_s24be", SampleRate: 48000, SampleDepth: 24}
+	wav32 := &library.Track{Path: "/music/g.wav", FileType: "wav", Codec: "pcm_s32le", SampleRate: 44100, SampleDepth: 32}
+	assert.False(t, rx.Plays(alac))
+	assert.False(t, rx.Plays(hires))
+	assert.True(t, rx.Plays(wav24))
+	assert.False(t, rx.Plays(wav32))
+	assert.Equal(t, "/usb/rex/e.wav.mp3", mediascanner.OutputPath(hires, "/usb/rex", "e.wav", rx, mp3))
+	assert.True(t, cdj.Plays(alac))
+	assert.True(t, cdj.Plays(hires))
+	assert.False(t, cdj.Plays(wav32))
+	assert.False(t, rx.SupportsProfile(&mediascanner.TranscodeProfile{Extension: "wav", SampleRate: 96000}))
+	assert.True(t, cdj.SupportsProfile(&mediascanner.TranscodeProfile{Extension: "wav", SampleRate: 96000}))
+
+	_, err = mediascanner.TargetFromString("cdj100")
+	assert.Error(t, err)
+}
+
+// Profiles that keep the source sample rate never produce files the target can not play.
+func TestTarget_ProfileFor(t *testing.T) {
+	rx, err := mediascanner.TargetFromString("XDJ-RX")
+	assert.NoError(t, err)
+	wav := &mediascanner.TranscodeProfile{Codec: "pcm", Extension: "wav"}
+	mp3 := mediascanner.TranscodeProfiles[mediascanner.DefaultTranscodeProfile]
+
+	assert.True(t, rx.SupportsProfile(wav))
+	assert.Equal(t, 48000, rx.ProfileFor(&library.Track{SampleRate: 96000}, wav).SampleRate)
+	assert.Equal(t, 48000, rx.ProfileFor(&library.Track{}, wav).SampleRate)
+	assert.Equal(t, 0, rx.ProfileFor(&library.Track{SampleRate: 44100}, wav).SampleRate)
+	assert.Equal(t, 0, wav.SampleRate, "the profile itself is not changed")
+	assert.Same(t, mp3, rx.ProfileFor(&library.Track{SampleRate: 96000}, mp3))
+}
+
+// Files with the same name in different directories are rendered to different files.
+func TestOutputNames(t *testing.T) {
+	names := mediascanner.OutputNames([]string{
+		"/music/House/01 Intro.mp3",
+		"/music/Techno/01 Intro.mp3",
+		"/music/outro.mp3",
+		"/elsewhere/other.mp3",
+	}, "/music")
+
+	assert.Equal(t, map[string]string{
+		"/music/House/01 Intro.mp3":  "House/01 Intro.mp3",
+		"/music/Techno/01 Intro.mp3": "Techno/01 Intro.mp3",
+		"/music/outro.mp3":           "outro.mp3",
+		"/elsewhere/other.mp3":       "other.mp3",
+	}, names)
+
+	tr := &library.Track{Path: "/music/House/01 Intro.mp3", FileType: "mp3"}
+	cdj, err := mediascanner.TargetFromString("cdj3000")
+	assert.NoError(t, err)
+	mp3 := mediascanner.TranscodeProfiles[mediascanner.DefaultTranscodeProfile]
+	assert.Equal(t, "/usb/rex/House/01 Intro.mp3", mediascanner.OutputPath(tr, "/usb/rex", names[tr.Path], cdj, mp3))
+}
+
+// Tracks with the same file name get unique names, which do not depend on the order of the tracks.
+func TestOutputNames_Duplicates(t *testing.T) {
+	paths := []string{
+		"/music/Album A/01 Intro.mp3",
+		"/music/Album B/01 Intro.mp3",
+		"/music/Album C/01 intro.MP3",
+		"/music/Album D/02 Outro.mp3",
+	}
+	names := mediascanner.OutputNames(paths, "")
+
+	assert.Equal(t, "02 Outro.mp3", names["/music/Album D/02 Outro.mp3"])
+	unique := make(map[string]bool)
+	for _, path := range paths[:3] {
+		name := strings.ToLower(names[path])
+		assert.Regexp(t, `^01 intro-[0-9a-f]{8}\.mp3$`, name)
+		assert.False(t, unique[name], "duplicate name %q", name)
+		unique[name] = true
+	}
+
+	reversed := []string{paths[3], paths[2], paths[1], paths[0]}
+	assert.Equal(t, names, mediascanner.OutputNames(reversed, ""))
+}
+
+func TestPdbTrack_FileType(t *testing.T) {
+	lib := library.New()
+	added := time.Now()
+	for path, expected := range map[string]track.FileType{
+		"/usb/rex/a.flac":     track.FileTypeFLAC,
+		"/usb/rex/b.flac.mp3": track.FileTypeMP3,
+		"/usb/rex/c.m4a":      track.FileTypeM4A,
+		"/usb/rex/d.AIFF":     track.FileTypeAIFF,
+		"/usb/rex/e.wav":      track.FileTypeWAV,
+	} {
+		tr := &library.Track{Path: path, OutputPath: path, AddedDate: &added}
+		lib.InsertTrack(tr)
+		row := mediascanner.PdbTrack(lib, tr, "/usb", nil)
+		assert.Equal(t, expected, row.FileType, path)
+	}
+}
@@ -0,0 +1,165 @@
+package mediascanner
+
+// Transcode audio files into formats supported by the players.
+
+import (
+	`context`
+	`encoding/json`
+	`fmt`
+	`os`
+	`os/exec`
+	`sort`
+	`strconv`
+	`strings`
+)
+
+// Options for encoding audio files with FFMPEG.
+// Zero values keep the bitrate, sample rate, sample depth and channels of the source file.
+type TranscodeProfile struct {
+	Name        string   `json:"name"`
+	Codec       string   `json:"codec"`        // FFMPEG encoder, or "pcm" for uncompressed audio of the given sample depth.
+	Extension   string   `json:"extension"`    // File extension of the output, which also decides the container format.
+	Bitrate     int      `json:"bitrate"`      // Constant bitrate in kbit/s.
+	SampleRate  int      `json:"sample_rate"`  // Hz.
+	SampleDepth int      `json:"sample_depth"` // Bits per sample, only used for uncompressed audio.
+	Channels    int      `json:"channels"`
+	Options     []string `json:"options"` // Extra FFMPEG output options.
+}
+
+// Name of the profile used when none is given.
+// Older players have trouble seeking in VBR files, and with sample rates above 48 kHz.
+const DefaultTranscodeProfile = "mp3-320"
+
+var TranscodeProfiles = map[string]*TranscodeProfile{
+	"mp3-320": {
+		Name:       "mp3-320",
+		Codec:      "libmp3lame",
+		Extension:  "mp3",
+		Bitrate:    320,
+		SampleRate: 44100,
+		Channels:   2,
+		Options:    []string{"-joint_stereo", "0"},
+	},
+	"mp3-v0": {
+		Name:       "mp3-v0",
+		Codec:      "libmp3lame",
+		Extension:  "mp3",
+		SampleRate: 44100,
+		Channels:   2,
+		Options:    []string{"-qscale:a", "0", "-joint_stereo", "0"},
+	},
+	"aac-256": {
+		Name:       "aac-256",
+		Codec:      "aac",
+		Extension:  "m4a",
+		Bitrate:    256,
+		SampleRate: 44100,
+		Channels:   2,
+	},
+	"wav": {
+		Name:        "wav",
+		Codec:       "pcm",
+		Extension:   "wav",
+		SampleRate:  44100,
+		SampleDepth: 16,
+		Channels:    2,
+	},
+	"aiff": {
+		Name:        "aiff",
+		Codec:       "pcm",
+		Extension:   "aiff",
+		SampleRate:  44100,
+		SampleDepth: 16,
+		Channels:    2,
+	},
+}
+
+func TranscodeProfileFromString(name string) (*TranscodeProfile, error) {
+	profile, found := TranscodeProfiles[strings.ToLower(name)]
+	if !found {
+		return nil, fmt.Errorf("unknown transcode profile '%s', expected one of: %s", name, strings.Join(TranscodeProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// Names of all transcode profiles, in alphabetical order.
+func TranscodeProfileNames() []string {
+	names := make([]string, 0, len(TranscodeProfiles))
+	for name := range TranscodeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Read a JSON file with a list of transcode profiles,
+// adding them to the known profiles and replacing any with the same name.
+func LoadTranscodeProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	profiles := make([]*TranscodeProfile, 0)
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, profile := range profiles {
+		if len(profile.Name) == 0 || len(profile.Codec) == 0 || len(profile.Extension) == 0 {
+			return fmt.Errorf("%s: transcode profiles must have a name, codec and extension", path)
+		}
+		TranscodeProfiles[strings.ToLower(profile.Name)] = profile
+	}
+	return nil
+}
+
+// FFMPEG encoder of the profile.
+// Uncompressed audio is big endian in AIFF files, and little endian otherwise.
+func (profile *TranscodeProfile) encoder() string {
+	if profile.Codec != "pcm" {
+		return profile.Codec
+	}
+	depth := profile.SampleDepth
+	if depth == 0 {
+		depth = 16
+	}
+	endianness := "le"
+	switch strings.ToLower(profile.Extension) {
+	case "aif", "aiff":
+		endianness = "be"
+	}
+	return fmt.Sprintf("pcm_s%d%s", depth, endianness)
+}
+
+// FFMPEG options for encoding an audio file with this profile.
+func (profile *TranscodeProfile) Args(src, dst string) []string {
+	args := []string{
+		"-i", src,
+		"-map_metadata", "0",
+		"-codec:a", profile.encoder(),
+	}
+	if profile.Codec == "pcm" {
+		// Embedded cover art can not be stored in uncompressed audio files.
+		args = append(args, "-vn")
+	}
+	if profile.Bitrate > 0 {
+		args = append(args, "-b:a", strconv.Itoa(profile.Bitrate)+"k")
+	}
+	if profile.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(profile.SampleRate))
+	}
+	if profile.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(profile.Channels))
+	}
+	args = append(args, profile.Options...)
+	return append(args, dst)
+}
+
+func Transcode(ctx context.Context, src, dst string, profile *TranscodeProfile) error {
+	proc := exec.CommandContext(ctx, "ffmpeg", profile.Args(src, dst)...)
+	out, err := proc.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, string(out))
+	}
+	return nil
+}
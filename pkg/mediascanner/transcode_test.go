@@ -0,0 +1,102 @@
+package mediascanner_test
+
+import (
+	`encoding/json`
+	`os`
+	`path/filepath`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/mediascanner`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestTranscodeProfile_Args(t *testing.T) {
+	mp3, err := mediascanner.TranscodeProfileFromString("MP3-320")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"-i", "in.flac",
+		"-map_metadata", "0",
+		"-codec:a", "libmp3lame",
+		"-b:a", "320k",
+		"-ar", "44100",
+		"-ac", "2",
+		"-joint_stereo", "0",
+		"out.mp3",
+	}, mp3.Args("in.flac", "out.mp3"))
+
+	aiff, err := mediascanner.TranscodeProfileFromString("aiff")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"-i", "in.flac",
+		"-map_metadata", "0",
+		"-codec:a", "pcm_s16be",
+		"-vn",
+		"-ar", "44100",
+		"-ac", "2",
+		"out.aiff",
+	}, aiff.Args("in.flac", "out.aiff"))
+
+	wav24 := &mediascanner.TranscodeProfile{Codec: "pcm", Extension: "wav", SampleDepth: 24}
+	assert.Contains(t, wav24.Args("in.flac", "out.wav"), "pcm_s24le")
+
+	_, err = mediascanner.TranscodeProfileFromString("ogg")
+	assert.Error(t, err)
+}
+
+func TestLoadTranscodeProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	err := os.WriteFile(path, []byte(`[
+		{"name": "mp3-256", "codec": "libmp3lame", "extension": "mp3", "bitrate": 256, "sample_rate": 48000}
+	]`), 0644)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mediascanner.LoadTranscodeProfiles(path))
+	defer delete(mediascanner.TranscodeProfiles, "mp3-256")
+
+	profile, err := mediascanner.TranscodeProfileFromString("mp3-256")
+	assert.NoError(t, err)
+	assert.Equal(t, 256, profile.Bitrate)
+	assert.Equal(t, 48000, profile.SampleRate)
+
+	err = os.WriteFile(path, []byte(`[{"name": "broken"}]`), 0644)
+	assert.NoError(t, err)
+	assert.Error(t, mediascanner.LoadTranscodeProfiles(path))
+}
+
+func TestApplyOutputProbe(t *testing.T) {
+	probe := &mediascanner.Probe{}
+	err := json.Unmarshal([]byte(`{
+		"streams": [
+			{"codec_type": "video", "codec_name": "mjpeg"},
+			{"codec_type": "audio", "codec_name": "mp3", "sample_rate": "44100", "bits_per_sample": 0}
+		],
+		"format": {"size": "12345678", "bit_rate": "320000"}
+	}`), probe)
+	assert.NoError(t, err)
+
+	tr := &library.Track{SampleRate: 96000, SampleDepth: 24, Bitrate: 4608, FileSize: 99999999}
+	mediascanner.ApplyOutputProbe(tr, probe)
+
+	assert.Equal(t, 12345678, tr.FileSize)
+	assert.Equal(t, 320, tr.Bitrate)
+	assert.Equal(t, 44100.0, tr.SampleRate)
+	assert.Equal(t, 16, tr.SampleDepth)
+}
+
+func TestApplySourceProbe(t *testing.T) {
+	probe := &mediascanner.Probe{}
+	err := json.Unmarshal([]byte(`{
+		"streams": [
+			{"codec_type": "audio", "codec_name": "alac", "sample_fmt": "s32p", "sample_rate": "96000", "bits_per_raw_sample": "24"}
+		]
+	}`), probe)
+	assert.NoError(t, err)
+
+	tr := &library.Track{FileType: "m4a", SampleRate: 44100}
+	mediascanner.ApplySourceProbe(tr, probe)
+
+	assert.Equal(t, "alac", tr.Codec)
+	assert.Equal(t, 96000.0, tr.SampleRate)
+	assert.Equal(t, 24, tr.SampleDepth)
+}
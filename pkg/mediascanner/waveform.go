@@ -0,0 +1,242 @@
+package mediascanner
+
+// Decode audio with FFMPEG and measure the levels used for drawing waveforms.
+
+import (
+	`bufio`
+	`context`
+	`encoding/binary`
+	`errors`
+	`fmt`
+	`io`
+	`math`
+	`os/exec`
+	`strconv`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/ambientsound/rex/pkg/rekordbox/anlz`
+)
+
+const (
+	waveformSampleRate = 22050
+	segmentLength      = waveformSampleRate / anlz.WaveformDetailRate
+
+	// Crossover frequencies between the low, mid and high bands.
+	lowCrossover  = 200
+	highCrossover = 2000
+)
+
+// Single pole low-pass filter.
+type lowPass struct {
+	alpha float64
+	value float64
+}
+
+func newLowPass(cutoff float64) *lowPass {
+	return &lowPass{
+		alpha: 1 - math.Exp(-2*math.Pi*cutoff/waveformSampleRate),
+	}
+}
+
+func (f *lowPass) filter(x float64) float64 {
+	f.value += f.alpha * (x - f.value)
+	return f.value
+}
+
+// Decode an audio file into mono PCM and measure its levels
+// in segments of 1/150th of a second.
+func ScanWaveform(ctx context.Context, src string) ([]library.WaveformSegment, error) {
+	proc := exec.CommandContext(ctx, "ffmpeg",
+		"-v", "error",
+		"-i", src,
+		"-f", "s16le",
+		"-ac", "1",
+		"-ar", strconv.Itoa(waveformSampleRate),
+		"pipe:1",
+	)
+	stdout, err := proc.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = proc.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := measureWaveform(bufio.NewReader(stdout))
+	if err != nil {
+		_ = proc.Wait()
+		return nil, err
+	}
+
+	err = proc.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", src, err)
+	}
+
+	return segments, nil
+}
+
+func measureWaveform(r io.Reader) ([]library.WaveformSegment, error) {
+	low := newLowPass(lowCrossover)
+	high := newLowPass(highCrossover)
+
+	segments := make([]library.WaveformSegment, 0)
+	segment := library.WaveformSegment{}
+	samples := 0
+
+	flush := func() {
+		segment.Low = math.Sqrt(segment.Low / float64(samples))
+		segment.Mid = math.Sqrt(segment.Mid / float64(samples))
+		segment.High = math.Sqrt(segment.High / float64(samples))
+		segments = append(segments, segment)
+		segment = library.WaveformSegment{}
+		samples = 0
+	}
+
+	// Samples are decoded a block at a time. A trailing odd byte is ignored.
+	buf := make([]byte, 2*segmentLength)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			break
+		} else if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+
+		for i := 0; i+1 < n; i += 2 {
+			sample := int16(binary.LittleEndian.Uint16(buf[i:]))
+			x := float64(sample) / math.MaxInt16
+			lo := low.filter(x)
+			lohi := high.filter(x)
+
+			segment.Peak = math.Max(segment.Peak, math.Abs(x))
+			segment.Low += lo * lo
+			segment.Mid += (lohi - lo) * (lohi - lo)
+			segment.High += (x - lohi) * (x - lohi)
+			samples++
+
+			if samples == segmentLength {
+				flush()
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	if samples > 0 {
+		flush()
+	}
+
+	return segments, nil
+}
+
+// Combine waveform segments into a fixed number of columns, keeping the loudest peak of each column.
+func resampleWaveform(segments []library.WaveformSegment, columns int) []library.WaveformSegment {
+	result := make([]library.WaveformSegment, columns)
+	if len(segments) == 0 {
+		return result
+	}
+	for i := range result {
+		start := i * len(segments) / columns
+		end := (i + 1) * len(segments) / columns
+		if end <= start {
+			end = start + 1
+		}
+		for _, segment := range segments[start:end] {
+			result[i].Peak = math.Max(result[i].Peak, segment.Peak)
+			result[i].Low = math.Max(result[i].Low, segment.Low)
+			result[i].Mid = math.Max(result[i].Mid, segment.Mid)
+			result[i].High = math.Max(result[i].High, segment.High)
+		}
+	}
+	return result
+}
+
+// Scale a value in the range 0-1 to an integer in the range 0-max.
+func scale(value float64, max int) uint8 {
+	return uint8(math.Round(math.Min(math.Max(value, 0), 1) * float64(max)))
+}
+
+// Tracks with more treble are drawn with whiter columns.
+func whiteness(segment library.WaveformSegment) uint8 {
+	total := segment.Low + segment.Mid + segment.High
+	if total == 0 {
+		return 0
+	}
+	return scale(segment.High/total*2, 7)
+}
+
+// Color components, relative to the strongest frequency band.
+func colors(segment library.WaveformSegment) (red, green, blue float64) {
+	strongest := math.Max(segment.Low, math.Max(segment.Mid, segment.High))
+	if strongest == 0 {
+		return
+	}
+	return segment.Low / strongest, segment.Mid / strongest, segment.High / strongest
+}
+
+func PdbWaveformPreview(waveform []library.WaveformSegment) *anlz.WaveformPreview {
+	columns := resampleWaveform(waveform, anlz.WaveformPreviewLength)
+	w := &anlz.WaveformPreview{
+		Data: make([]byte, len(columns)),
+	}
+	for i, column := range columns {
+		w.Data[i] = anlz.MonochromeColumn(scale(column.Peak, 31), whiteness(column))
+	}
+	return w
+}
+
+func PdbTinyWaveformPreview(waveform []library.WaveformSegment) *anlz.TinyWaveformPreview {
+	columns := resampleWaveform(waveform, anlz.TinyWaveformPreviewLength)
+	w := &anlz.TinyWaveformPreview{
+		Data: make([]byte, len(columns)),
+	}
+	for i, column := range columns {
+		w.Data[i] = scale(column.Peak, 15)
+	}
+	return w
+}
+
+func PdbWaveformDetail(waveform []library.WaveformSegment) *anlz.WaveformDetail {
+	w := &anlz.WaveformDetail{
+		Data: make([]byte, len(waveform)),
+	}
+	for i, segment := range waveform {
+		w.Data[i] = anlz.MonochromeColumn(scale(segment.Peak, 31), whiteness(segment))
+	}
+	return w
+}
+
+func PdbColorWaveformPreview(waveform []library.WaveformSegment) *anlz.ColorWaveformPreview {
+	columns := resampleWaveform(waveform, anlz.ColorWaveformPreviewLength)
+	w := &anlz.ColorWaveformPreview{
+		Data: make([][6]byte, len(columns)),
+	}
+	for i, column := range columns {
+		height := scale(column.Peak, 127)
+		red, green, blue := colors(column)
+		w.Data[i] = [6]byte{
+			height,
+			height,
+			height,
+			scale(red*column.Peak, 127),
+			scale(green*column.Peak, 127),
+			scale(blue*column.Peak, 127),
+		}
+	}
+	return w
+}
+
+func PdbColorWaveformDetail(waveform []library.WaveformSegment) *anlz.ColorWaveformDetail {
+	w := &anlz.ColorWaveformDetail{
+		Data: make([]uint16, len(waveform)),
+	}
+	for i, segment := range waveform {
+		red, green, blue := colors(segment)
+		w.Data[i] = anlz.ColorColumn(scale(red, 7), scale(green, 7), scale(blue, 7), scale(segment.Peak, 31))
+	}
+	return w
+}
@@ -0,0 +1,55 @@
+package mediascanner
+
+import (
+	`bytes`
+	`encoding/binary`
+	`math`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/library`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestMeasureWaveform(t *testing.T) {
+	// One second of a full scale 50 Hz sine, followed by one second of silence.
+	samples := make([]int16, waveformSampleRate*2)
+	for i := 0; i < waveformSampleRate; i++ {
+		samples[i] = int16(math.Sin(2*math.Pi*50*float64(i)/waveformSampleRate) * math.MaxInt16)
+	}
+	buf := &bytes.Buffer{}
+	assert.NoError(t, binary.Write(buf, binary.LittleEndian, samples))
+
+	segments, err := measureWaveform(buf)
+
+	assert.NoError(t, err)
+	assert.Len(t, segments, 300)
+	assert.InDelta(t, 1.0, resampleWaveform(segments, 1)[0].Peak, 0.01)
+	assert.Greater(t, segments[10].Low, segments[10].High)
+	assert.Equal(t, library.WaveformSegment{}, segments[299])
+}
+
+// Samples that do not fill a whole block or segment are measured too.
+func TestMeasureWaveform_Partial(t *testing.T) {
+	samples := make([]int16, segmentLength+3)
+	samples[segmentLength+1] = math.MaxInt16
+	buf := &bytes.Buffer{}
+	assert.NoError(t, binary.Write(buf, binary.LittleEndian, samples))
+	buf.WriteByte(0xff)
+
+	segments, err := measureWaveform(buf)
+
+	assert.NoError(t, err)
+	assert.Len(t, segments, 2)
+	assert.Zero(t, segments[0].Peak)
+	assert.Equal(t, 1.0, segments[1].Peak)
+}
+
+func TestResampleWaveform(t *testing.T) {
+	segments := []library.WaveformSegment{
+		{Peak: 0.1}, {Peak: 0.5}, {Peak: 0.2}, {Peak: 0.3},
+	}
+
+	columns := resampleWaveform(segments, 2)
+
+	assert.Equal(t, []library.WaveformSegment{{Peak: 0.5}, {Peak: 0.3}}, columns)
+}
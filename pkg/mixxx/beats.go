@@ -0,0 +1,171 @@
+package mixxx
+
+import (
+	`bytes`
+	`encoding/binary`
+	`fmt`
+	`math`
+)
+
+// Beat positions decoded from the `beats` column of the library table.
+// Positions are measured in frames, i.e. stereo sample pairs, from the start of the track.
+type Beats struct {
+	// Constant tempo and position of the first beat. Only set for beat grids.
+	Bpm       float64
+	FirstBeat float64
+	// Positions of every enabled beat. Only set for beat maps.
+	Frames []float64
+}
+
+const (
+	BeatGridVersion1 = "BeatGrid-1.0"
+	BeatGridVersion2 = "BeatGrid-2.0"
+	BeatMapVersion1  = "BeatMap-1.0"
+)
+
+// Parse the beats blob according to the `beats_version` column.
+//
+// BeatGrid-1.0 is a legacy format holding two native doubles: the tempo and the first beat, measured in samples.
+// The other versions are protocol buffer messages from Mixxx' `beats.proto`.
+func ParseBeats(version string, data []byte) (*Beats, error) {
+	switch version {
+	case BeatGridVersion1:
+		legacy := struct {
+			Bpm       float64
+			FirstBeat float64
+		}{}
+		err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &legacy)
+		if err != nil {
+			return nil, err
+		}
+		return &Beats{
+			Bpm:       legacy.Bpm,
+			FirstBeat: legacy.FirstBeat / 2,
+		}, nil
+	case BeatGridVersion2:
+		return parseBeatGrid(data)
+	case BeatMapVersion1:
+		return parseBeatMap(data)
+	default:
+		return nil, fmt.Errorf("unsupported beats version '%s'", version)
+	}
+}
+
+//	message BeatGrid {
+//	  optional Bpm bpm = 1;
+//	  optional Beat first_beat = 2;
+//	}
+func parseBeatGrid(data []byte) (*Beats, error) {
+	beats := &Beats{}
+	err := decodeProto(data, func(field int, value protoValue) error {
+		switch field {
+		case 1:
+			return decodeProto(value.bytes, func(field int, value protoValue) error {
+				if field == 1 {
+					beats.Bpm = math.Float64frombits(value.varint)
+				}
+				return nil
+			})
+		case 2:
+			frame, _, err := parseBeat(value.bytes)
+			beats.FirstBeat = frame
+			return err
+		}
+		return nil
+	})
+	return beats, err
+}
+
+//	message BeatMap {
+//	  repeated Beat beat = 1;
+//	}
+func parseBeatMap(data []byte) (*Beats, error) {
+	beats := &Beats{
+		Frames: make([]float64, 0),
+	}
+	err := decodeProto(data, func(field int, value protoValue) error {
+		if field != 1 {
+			return nil
+		}
+		frame, enabled, err := parseBeat(value.bytes)
+		if enabled {
+			beats.Frames = append(beats.Frames, frame)
+		}
+		return err
+	})
+	return beats, err
+}
+
+//	message Beat {
+//	  optional int32 frame_position = 1;
+//	  optional bool enabled = 2 [ default = true ];
+//	  optional Source source = 3 [ default = ANALYZER ];
+//	}
+func parseBeat(data []byte) (frame float64, enabled bool, err error) {
+	enabled = true
+	err = decodeProto(data, func(field int, value protoValue) error {
+		switch field {
+		case 1:
+			frame = float64(int32(value.varint))
+		case 2:
+			enabled = value.varint != 0
+		}
+		return nil
+	})
+	return
+}
+
+// Holds a single decoded protobuf value. Fixed-size and varint values
+// are stored in `varint`, length-delimited values in `bytes`.
+type protoValue struct {
+	varint uint64
+	bytes  []byte
+}
+
+// Minimal protocol buffer decoder, calling `fn` for every field found in the message.
+func decodeProto(data []byte, fn func(field int, value protoValue) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("malformed protobuf tag")
+		}
+		data = data[n:]
+
+		value := protoValue{}
+		switch tag & 0x7 {
+		case 0:
+			value.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("malformed protobuf varint")
+			}
+		case 1:
+			if len(data) < 8 {
+				return fmt.Errorf("malformed protobuf fixed64")
+			}
+			value.varint = binary.LittleEndian.Uint64(data)
+			n = 8
+		case 2:
+			length, ln := binary.Uvarint(data)
+			if ln <= 0 || uint64(len(data)-ln) < length {
+				return fmt.Errorf("malformed protobuf length")
+			}
+			value.bytes = data[ln : ln+int(length)]
+			n = ln + int(length)
+		case 5:
+			if len(data) < 4 {
+				return fmt.Errorf("malformed protobuf fixed32")
+			}
+			value.varint = uint64(binary.LittleEndian.Uint32(data))
+			n = 4
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", tag&0x7)
+		}
+		data = data[n:]
+
+		err := fn(int(tag>>3), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
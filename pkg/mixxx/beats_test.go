@@ -0,0 +1,42 @@
+package mixxx_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/mixxx`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestParseBeats_BeatGrid(t *testing.T) {
+	// bpm { bpm: 128.0 } first_beat { frame_position: 1000 }
+	data := []byte{
+		0x0a, 0x09, 0x09, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x60, 0x40,
+		0x12, 0x03, 0x08, 0xe8, 0x07,
+	}
+
+	beats, err := mixxx.ParseBeats(mixxx.BeatGridVersion2, data)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 128.0, beats.Bpm)
+	assert.Equal(t, 1000.0, beats.FirstBeat)
+	assert.Empty(t, beats.Frames)
+}
+
+func TestParseBeats_BeatMap(t *testing.T) {
+	// beat { frame_position: 100 } beat { frame_position: 200, enabled: false } beat { frame_position: 300 }
+	data := []byte{
+		0x0a, 0x02, 0x08, 0x64,
+		0x0a, 0x05, 0x08, 0xc8, 0x01, 0x10, 0x00,
+		0x0a, 0x03, 0x08, 0xac, 0x02,
+	}
+
+	beats, err := mixxx.ParseBeats(mixxx.BeatMapVersion1, data)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{100, 300}, beats.Frames)
+}
+
+func TestParseBeats_UnknownVersion(t *testing.T) {
+	_, err := mixxx.ParseBeats("BeatFoo-1.0", nil)
+	assert.Error(t, err)
+}
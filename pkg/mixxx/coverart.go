@@ -0,0 +1,8 @@
+package mixxx
+
+// Values of the `coverart_type` column in the library table.
+const (
+	CoverArtTypeNone     = 0
+	CoverArtTypeMetadata = 1 // Embedded in the audio file
+	CoverArtTypeFile     = 2 // Image file, path in `coverart_location`
+)
@@ -0,0 +1,17 @@
+package mixxx
+
+// Values of the `type` column in the cues table.
+const (
+	CueTypeInvalid   = 0
+	CueTypeHotCue    = 1
+	CueTypeMainCue   = 2
+	CueTypeBeat      = 3 // Unused
+	CueTypeLoop      = 4
+	CueTypeJump      = 5
+	CueTypeIntro     = 6
+	CueTypeOutro     = 7
+	CueTypeAudibleAt = 8 // First sound above -60 dB
+)
+
+// Cues without a hot cue number have this value in the `hotcue` column.
+const NoHotCue = -1
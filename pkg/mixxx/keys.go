@@ -0,0 +1,135 @@
+package mixxx
+
+import (
+	`fmt`
+	`strconv`
+	`strings`
+)
+
+// Musical key notations that can be written to the KEYS table.
+type KeyNotation int
+
+const (
+	KeyNotationStandard KeyNotation = iota
+	KeyNotationCamelot
+)
+
+// Mixxx stores detected keys in `library.key_id` as a ChromaticKey enum value.
+// Zero means that the key is invalid or unknown, 1-12 are major keys starting at C,
+// and 13-24 are minor keys starting at C minor.
+var standardKeys = []string{
+	"",
+	"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B",
+	"Cm", "C#m", "Dm", "Ebm", "Em", "Fm", "F#m", "Gm", "G#m", "Am", "Bbm", "Bm",
+}
+
+var camelotKeys = []string{
+	"",
+	"8B", "3B", "10B", "5B", "12B", "7B", "2B", "9B", "4B", "11B", "6B", "1B",
+	"5A", "12A", "7A", "2A", "9A", "4A", "11A", "6A", "1A", "8A", "3A", "10A",
+}
+
+func KeyNotationFromString(s string) (KeyNotation, error) {
+	switch s {
+	case "standard":
+		return KeyNotationStandard, nil
+	case "camelot":
+		return KeyNotationCamelot, nil
+	default:
+		return KeyNotationStandard, fmt.Errorf("unknown key notation '%s'", s)
+	}
+}
+
+// Returns the name of a Mixxx key ID in the given notation,
+// or an empty string if the key is unknown.
+func KeyName(keyID int64, notation KeyNotation) string {
+	if keyID <= 0 || int(keyID) >= len(standardKeys) {
+		return ""
+	}
+	switch notation {
+	case KeyNotationCamelot:
+		return camelotKeys[keyID]
+	default:
+		return standardKeys[keyID]
+	}
+}
+
+// Pitch classes of note names, counted in semitones from C.
+var pitchClasses = map[byte]int{
+	'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11,
+}
+
+// Returns the Mixxx key ID of a key written as text, e.g. "Am", "F# minor", "8A" or "1d",
+// or zero if the text is not a key.
+// Standard, Camelot and OpenKey notations are understood.
+func ParseKey(text string) int64 {
+	text = strings.TrimSpace(text)
+	if len(text) < 2 {
+		return parseStandardKey(text)
+	}
+
+	// Camelot and OpenKey notations are a number followed by a letter.
+	number, err := strconv.Atoi(text[:len(text)-1])
+	if err == nil {
+		if number < 1 || number > 12 {
+			return 0
+		}
+		switch strings.ToUpper(text[len(text)-1:]) {
+		case "A", "B":
+			return camelotKeyID(strconv.Itoa(number) + strings.ToUpper(text[len(text)-1:]))
+		case "M":
+			return camelotKeyID(strconv.Itoa((number+6)%12+1) + "A")
+		case "D":
+			return camelotKeyID(strconv.Itoa((number+6)%12+1) + "B")
+		default:
+			return 0
+		}
+	}
+
+	return parseStandardKey(text)
+}
+
+func camelotKeyID(name string) int64 {
+	for i := range camelotKeys {
+		if i > 0 && camelotKeys[i] == name {
+			return int64(i)
+		}
+	}
+	return 0
+}
+
+func parseStandardKey(text string) int64 {
+	if len(text) == 0 {
+		return 0
+	}
+	pitch, found := pitchClasses[strings.ToUpper(text)[0]]
+	if !found {
+		return 0
+	}
+	text = text[1:]
+
+	switch {
+	case strings.HasPrefix(text, "#"):
+		pitch++
+		text = text[1:]
+	case strings.HasPrefix(text, "♯"):
+		pitch++
+		text = text[len("♯"):]
+	case strings.HasPrefix(text, "b"):
+		pitch--
+		text = text[1:]
+	case strings.HasPrefix(text, "♭"):
+		pitch--
+		text = text[len("♭"):]
+	}
+	pitch = (pitch + 12) % 12
+
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "", "maj", "major":
+		return int64(pitch + 1)
+	case "m", "min", "minor":
+		return int64(pitch + 13)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,51 @@
+package mixxx_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/mixxx`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestKeyName(t *testing.T) {
+	assert.Equal(t, "C", mixxx.KeyName(1, mixxx.KeyNotationStandard))
+	assert.Equal(t, "8B", mixxx.KeyName(1, mixxx.KeyNotationCamelot))
+	assert.Equal(t, "Am", mixxx.KeyName(22, mixxx.KeyNotationStandard))
+	assert.Equal(t, "8A", mixxx.KeyName(22, mixxx.KeyNotationCamelot))
+	assert.Equal(t, "F#m", mixxx.KeyName(19, mixxx.KeyNotationStandard))
+	assert.Equal(t, "11A", mixxx.KeyName(19, mixxx.KeyNotationCamelot))
+	assert.Equal(t, "", mixxx.KeyName(0, mixxx.KeyNotationStandard))
+	assert.Equal(t, "", mixxx.KeyName(25, mixxx.KeyNotationCamelot))
+}
+
+func TestParseKey(t *testing.T) {
+	for text, keyID := range map[string]int64{
+		"C":        1,
+		"Db":       2,
+		"C#":       2,
+		"Am":       22,
+		"A minor":  22,
+		"F#m":      19,
+		"Gbm":      19,
+		"Bbm":      23,
+		"A#m":      23,
+		"Cb":       12,
+		"8A":       22,
+		"8a":       22,
+		"8B":       1,
+		"11A":      19,
+		"1m":       22,
+		"1d":       1,
+		"12d":      6,
+		"":         0,
+		"13A":      0,
+		"H":        0,
+		"A dorian": 0,
+	} {
+		assert.Equal(t, keyID, mixxx.ParseKey(text), text)
+	}
+
+	// Keys are written back in the same notation regardless of how they were read.
+	assert.Equal(t, "8A", mixxx.KeyName(mixxx.ParseKey("Am"), mixxx.KeyNotationCamelot))
+	assert.Equal(t, "Am", mixxx.KeyName(mixxx.ParseKey("8A"), mixxx.KeyNotationStandard))
+}
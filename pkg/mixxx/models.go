@@ -22,13 +22,24 @@ type CrateTrack struct {
 	TrackID int64
 }
 
+type Cue struct {
+	ID       int64
+	TrackID  int64
+	Type     int64
+	Position int64
+	Length   int64
+	Hotcue   int64
+	Label    string
+	Color    int64
+}
+
 type Playlist struct {
 	ID           int64
 	Name         sql.NullString
 	Position     sql.NullInt64
 	Hidden       int64
-	DateCreated  sql.NullTime
-	DateModified sql.NullTime
+	DateCreated  sql.NullString
+	DateModified sql.NullString
 	Locked       sql.NullInt64
 }
 
@@ -0,0 +1,13 @@
+package mixxx
+
+// Values of the `hidden` column in the Playlists table.
+const (
+	PlaylistVisible = 0
+	PlaylistAutoDJ  = 1
+	PlaylistSetLog  = 2 // Shown as history in Mixxx.
+)
+
+// DateTimeFormat is the layout of the date columns in the Playlists and
+// PlaylistTracks tables. Mixxx stores them as UTC ISO 8601 text with
+// milliseconds, the way Qt writes a QDateTime.
+const DateTimeFormat = "2006-01-02T15:04:05.000"
@@ -23,3 +23,22 @@ SELECT tracklist.*, loc.location AS path FROM crate_tracks tracklist
 JOIN library ON library.id = tracklist.track_id
 JOIN track_locations loc ON library.location = loc.id
 WHERE tracklist.crate_id = ?;
+
+-- name: ListTrackCues :many
+SELECT * FROM cues
+WHERE track_id = ?
+ORDER BY position;
+
+-- name: CreatePlaylist :execlastid
+INSERT INTO Playlists (name, position, hidden, date_created, date_modified)
+VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM Playlists), ?, ?, ?);
+
+-- name: AddPlaylistTrack :exec
+INSERT INTO PlaylistTracks (playlist_id, track_id, position, pl_datetime_added)
+VALUES (?, ?, ?, ?);
+
+-- name: CreateCrate :execlastid
+INSERT INTO crates (name) VALUES (?);
+
+-- name: AddCrateTrack :exec
+INSERT OR IGNORE INTO crate_tracks (crate_id, track_id) VALUES (?, ?);
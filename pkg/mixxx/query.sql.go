@@ -10,6 +10,79 @@ import (
 	"database/sql"
 )
 
+const addCrateTrack = `-- name: AddCrateTrack :exec
+INSERT OR IGNORE INTO crate_tracks (crate_id, track_id) VALUES (?, ?)
+`
+
+type AddCrateTrackParams struct {
+	CrateID int64
+	TrackID int64
+}
+
+func (q *Queries) AddCrateTrack(ctx context.Context, arg AddCrateTrackParams) error {
+	_, err := q.db.ExecContext(ctx, addCrateTrack, arg.CrateID, arg.TrackID)
+	return err
+}
+
+const addPlaylistTrack = `-- name: AddPlaylistTrack :exec
+INSERT INTO PlaylistTracks (playlist_id, track_id, position, pl_datetime_added)
+VALUES (?, ?, ?, ?)
+`
+
+type AddPlaylistTrackParams struct {
+	PlaylistID      sql.NullInt64
+	TrackID         sql.NullInt64
+	Position        sql.NullInt64
+	PlDatetimeAdded sql.NullString
+}
+
+func (q *Queries) AddPlaylistTrack(ctx context.Context, arg AddPlaylistTrackParams) error {
+	_, err := q.db.ExecContext(ctx, addPlaylistTrack,
+		arg.PlaylistID,
+		arg.TrackID,
+		arg.Position,
+		arg.PlDatetimeAdded,
+	)
+	return err
+}
+
+const createCrate = `-- name: CreateCrate :execlastid
+INSERT INTO crates (name) VALUES (?)
+`
+
+func (q *Queries) CreateCrate(ctx context.Context, name string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createCrate, name)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const createPlaylist = `-- name: CreatePlaylist :execlastid
+INSERT INTO Playlists (name, position, hidden, date_created, date_modified)
+VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM Playlists), ?, ?, ?)
+`
+
+type CreatePlaylistParams struct {
+	Name         sql.NullString
+	Hidden       int64
+	DateCreated  sql.NullString
+	DateModified sql.NullString
+}
+
+func (q *Queries) CreatePlaylist(ctx context.Context, arg CreatePlaylistParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createPlaylist,
+		arg.Name,
+		arg.Hidden,
+		arg.DateCreated,
+		arg.DateModified,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
 const listCrateTracks = `-- name: ListCrateTracks :many
 SELECT tracklist.crate_id, tracklist.track_id, loc.location AS path FROM crate_tracks tracklist
 JOIN library ON library.id = tracklist.track_id
@@ -163,6 +236,44 @@ func (q *Queries) ListPlaylists(ctx context.Context) ([]Playlist, error) {
 	return items, nil
 }
 
+const listTrackCues = `-- name: ListTrackCues :many
+SELECT id, track_id, type, position, length, hotcue, label, color FROM cues
+WHERE track_id = ?
+ORDER BY position
+`
+
+func (q *Queries) ListTrackCues(ctx context.Context, trackID int64) ([]Cue, error) {
+	rows, err := q.db.QueryContext(ctx, listTrackCues, trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Cue{}
+	for rows.Next() {
+		var i Cue
+		if err := rows.Scan(
+			&i.ID,
+			&i.TrackID,
+			&i.Type,
+			&i.Position,
+			&i.Length,
+			&i.Hotcue,
+			&i.Label,
+			&i.Color,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTracks = `-- name: ListTracks :many
 SELECT library.id, library.artist, library.title, library.album, library.year, library.genre, library.tracknumber, library.location, library.comment, library.url, library.duration, library.bitrate, library.samplerate, library.bpm, library.wavesummaryhex, library.channels, library.datetime_added, library.mixxx_deleted, library.played, library.header_parsed, library.filetype, library.replaygain, library.timesplayed, library.rating, library."key", library.beats, library.beats_version, library.composer, library.bpm_lock, library.beats_sub_version, library.keys, library.keys_version, library.keys_sub_version, library.key_id, library.grouping, library.album_artist, library.coverart_source, library.coverart_type, library.coverart_location, library.coverart_hash, library.replaygain_peak, library.tracktotal, library.color, tl.location AS path, tl.filesize AS filesize
 FROM library
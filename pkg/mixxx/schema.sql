@@ -89,3 +89,14 @@ CREATE TABLE PlaylistTracks
     position          INTEGER,
     pl_datetime_added text
 );
+CREATE TABLE cues
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    track_id INTEGER                    NOT NULL REFERENCES library (id),
+    type     INTEGER DEFAULT 0          NOT NULL,
+    position INTEGER DEFAULT -1         NOT NULL,
+    length   INTEGER DEFAULT 0          NOT NULL,
+    hotcue   INTEGER DEFAULT -1         NOT NULL,
+    label    TEXT    DEFAULT ''         NOT NULL,
+    color    INTEGER DEFAULT 4294901760 NOT NULL
+);
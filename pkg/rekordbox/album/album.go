@@ -2,6 +2,8 @@ package album
 
 import (
 	`bytes`
+	`encoding/binary`
+	`io`
 
 	`github.com/ambientsound/rex/pkg/marshal`
 	`github.com/ambientsound/rex/pkg/rekordbox/dstring`
@@ -24,22 +26,55 @@ type Album struct {
 
 func (album *Album) MarshalBinary() ([]byte, error) {
 	buf := &bytes.Buffer{}
-	name := album.Name // FIXME: if this is a long UTF-16 string, then OfsName is observed to increment by two, and two bytes of zero filled between OfsName and the string.
+	name := album.Name
+	nameEncoder := dstring.New(name)
 	album.Name = ""
 	album.Unnamed1 = 0x80 // always this value?
 	album.Unnamed2 = 0    // always 0
-	album.OfsName = 22    // static position
+	album.OfsName = 22    // directly after the header
 	album.Unnamed3 = 0    // always 0
 	album.Unnamed4 = 0x03 // always 0x03
+
+	// UTF-16 names are observed to be aligned to four bytes, with zero padding between the header and the string.
+	_, utf16 := nameEncoder.(dstring.UnicodeString)
+	if utf16 {
+		album.OfsName += 2
+	}
+
 	err := marshal.PackInto(buf, &album)
+	album.Name = name
 	if err != nil {
 		return nil, err
 	}
-	nameEncoder := dstring.New(name)
+	if utf16 {
+		buf.Write([]byte{0, 0})
+	}
 	err = marshal.Into(buf, nameEncoder)
 	return buf.Bytes(), err
 }
 
+func (album *Album) UnmarshalBinary(data []byte) error {
+	const headerSize = 22
+	if len(data) < headerSize {
+		return io.ErrShortBuffer
+	}
+	album.Unnamed1 = binary.LittleEndian.Uint16(data[0:])
+	album.IndexShift = binary.LittleEndian.Uint16(data[2:])
+	album.Unnamed2 = binary.LittleEndian.Uint32(data[4:])
+	album.ArtistId = binary.LittleEndian.Uint32(data[8:])
+	album.Id = binary.LittleEndian.Uint32(data[12:])
+	album.Unnamed3 = binary.LittleEndian.Uint32(data[16:])
+	album.Unnamed4 = data[20]
+	album.OfsName = data[21]
+	if int(album.OfsName) >= len(data) {
+		return io.ErrShortBuffer
+	}
+
+	var err error
+	album.Name, err = dstring.UnmarshalBinary(data[album.OfsName:])
+	return err
+}
+
 func (album *Album) SetIndexShift(shift uint16) {
 	album.IndexShift = shift
 }
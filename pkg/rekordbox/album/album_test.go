@@ -26,3 +26,41 @@ func TestArtist_MarshalBinary(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expected, data)
 }
+
+func TestAlbum_UnmarshalBinary(t *testing.T) {
+	alb := &album.Album{}
+	err := alb.UnmarshalBinary([]byte{
+		0x80, 0x00, 0x20, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x16, 0x15, 0x46,
+		0x4a, 0x41, 0x41, 0x4b, 0x20, 0x30, 0x30, 0x36,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(10), alb.Id)
+	assert.Equal(t, uint32(0), alb.ArtistId)
+	assert.Equal(t, "FJAAK 006", alb.Name)
+}
+
+func TestAlbum_MarshalBinary_UTF16(t *testing.T) {
+	expected := []byte{
+		0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00,
+		0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x18, 0x00, 0x00,
+		0x90, 0x0e, 0x00, 0x00, 0x42, 0x00, 0x6a, 0x00, 0xf6, 0x00, 0x72, 0x00,
+		0x6b, 0x00,
+	}
+
+	alb := album.Album{
+		Name:     "Björk",
+		Id:       11,
+		ArtistId: 5,
+	}
+
+	data, err := alb.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+
+	decoded := &album.Album{}
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, "Björk", decoded.Name)
+	assert.Equal(t, uint32(5), decoded.ArtistId)
+}
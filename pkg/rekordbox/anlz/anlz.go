@@ -0,0 +1,88 @@
+package anlz
+
+// Pioneer analysis files, found in PIONEER/USBANLZ on export media.
+// See https://djl-analysis.deepsymmetry.org/rekordbox-export-analysis/anlz.html
+//
+// Unlike the PDB file, all numbers in analysis files are big-endian.
+
+import (
+	`bytes`
+	`encoding`
+	`encoding/binary`
+)
+
+const fileMagic = "PMAI"
+
+/**
+ * Analysis file header, followed by a number of tagged sections.
+ */
+type FileHeader struct {
+	Magic     [4]byte
+	LenHeader uint32
+	LenFile   uint32
+	Unknown1  uint32 // Always 0x00000001
+	Unknown2  uint32 // Always 0x00010000
+	Unknown3  uint32 // Always 0x00010000
+	Unknown4  uint32 // Always zero
+}
+
+// Common header for all sections.
+type SectionHeader struct {
+	Magic     [4]byte
+	LenHeader uint32 // Length of this header including section specific fields.
+	LenTag    uint32 // Length of the whole section, including the header.
+}
+
+type File struct {
+	Sections []encoding.BinaryMarshaler
+}
+
+func (f *File) MarshalBinary() ([]byte, error) {
+	body := &bytes.Buffer{}
+	for _, section := range f.Sections {
+		data, err := section.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		body.Write(data)
+	}
+
+	header := FileHeader{
+		LenHeader: uint32(binary.Size(FileHeader{})),
+		Unknown1:  0x1,
+		Unknown2:  0x10000,
+		Unknown3:  0x10000,
+	}
+	copy(header.Magic[:], fileMagic)
+	header.LenFile = header.LenHeader + uint32(body.Len())
+
+	buf := &bytes.Buffer{}
+	err := binary.Write(buf, binary.BigEndian, header)
+	if err != nil {
+		return nil, err
+	}
+	_, err = buf.Write(body.Bytes())
+	return buf.Bytes(), err
+}
+
+// Serialize a section. The common section header is generated, followed by
+// the section specific header fields and finally the section body.
+func marshalSection(magic string, header any, body []byte) ([]byte, error) {
+	sh := SectionHeader{
+		LenHeader: uint32(binary.Size(SectionHeader{}) + binary.Size(header)),
+	}
+	copy(sh.Magic[:], magic)
+	sh.LenTag = sh.LenHeader + uint32(len(body))
+
+	buf := &bytes.Buffer{}
+	err := binary.Write(buf, binary.BigEndian, sh)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, header)
+	if err != nil {
+		return nil, err
+	}
+	_, err = buf.Write(body)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,127 @@
+package anlz_test
+
+import (
+	`encoding`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/anlz`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestBeatGrid_MarshalBinary(t *testing.T) {
+	bg := &anlz.BeatGrid{
+		Beats: []anlz.Beat{
+			{BeatNumber: 1, Tempo: 12800, Time: 120},
+			{BeatNumber: 2, Tempo: 12800, Time: 589},
+		},
+	}
+
+	data, err := bg.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x50, 0x51, 0x54, 0x5a, 0x00, 0x00, 0x00, 0x18, 0x00, 0x00, 0x00, 0x28,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x01, 0x32, 0x00, 0x00, 0x00, 0x00, 0x78,
+		0x00, 0x02, 0x32, 0x00, 0x00, 0x00, 0x02, 0x4d,
+	}, data)
+}
+
+func TestFile_MarshalBinary(t *testing.T) {
+	f := &anlz.File{
+		Sections: []encoding.BinaryMarshaler{
+			&anlz.PathSection{Path: "/a"},
+		},
+	}
+
+	data, err := f.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x50, 0x4d, 0x41, 0x49, 0x00, 0x00, 0x00, 0x1c, 0x00, 0x00, 0x00, 0x32,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x50, 0x50, 0x54, 0x48, 0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x16,
+		0x00, 0x00, 0x00, 0x06, 0x00, 0x2f, 0x00, 0x61, 0x00, 0x00,
+	}, data)
+}
+
+func TestPath(t *testing.T) {
+	path := anlz.Path(0x1234)
+	assert.Equal(t, "/PIONEER/USBANLZ/P012/00001234/ANLZ0000.DAT", path)
+	assert.Equal(t, path[:len(path)-3]+"EXT", anlz.ExtPath(0x1234))
+
+	// Every track gets a directory of its own.
+	dirs := make(map[string]bool)
+	for id := uint32(1); id <= 50000; id++ {
+		dirs[anlz.Dir(id)] = true
+	}
+	assert.Len(t, dirs, 50000)
+}
+
+func TestCueList_MarshalBinary(t *testing.T) {
+	cl := &anlz.CueList{
+		Type: anlz.CueListHotCues,
+		Cues: []anlz.Cue{
+			{HotCue: 1, Type: anlz.CueTypePoint, Time: 1000},
+		},
+	}
+
+	data, err := cl.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x50, 0x43, 0x4f, 0x42, 0x00, 0x00, 0x00, 0x18, 0x00, 0x00, 0x00, 0x50,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff,
+		0x50, 0x43, 0x50, 0x54, 0x00, 0x00, 0x00, 0x1c, 0x00, 0x00, 0x00, 0x38,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0xff, 0x01, 0x00, 0x03, 0xe8, 0x00, 0x00, 0x03, 0xe8,
+		0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}, data)
+}
+
+func TestExtendedCueList_MarshalBinary(t *testing.T) {
+	cl := &anlz.ExtendedCueList{
+		Type: anlz.CueListHotCues,
+		Cues: []anlz.Cue{
+			{HotCue: 2, Type: anlz.CueTypeLoop, Time: 1000, LoopTime: 2000, Comment: "A", Red: 0xff},
+		},
+	}
+
+	data, err := cl.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x50, 0x43, 0x4f, 0x32, 0x00, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x48,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00,
+		0x50, 0x43, 0x50, 0x32, 0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x34,
+		0x00, 0x00, 0x00, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0xe8,
+		0x00, 0x00, 0x07, 0xd0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00, 0x41, 0x00, 0x00,
+		0x00, 0xff, 0x00, 0x00,
+	}, data)
+}
+
+func TestWaveformDetail_MarshalBinary(t *testing.T) {
+	w := &anlz.WaveformDetail{
+		Data: []byte{
+			anlz.MonochromeColumn(31, 7),
+			anlz.MonochromeColumn(1, 0),
+		},
+	}
+
+	data, err := w.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x50, 0x57, 0x56, 0x33, 0x00, 0x00, 0x00, 0x18, 0x00, 0x00, 0x00, 0x1a,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x96, 0x00, 0x00,
+		0xff, 0x01,
+	}, data)
+}
+
+func TestColorColumn(t *testing.T) {
+	assert.Equal(t, uint16(0xfffc), anlz.ColorColumn(7, 7, 7, 31))
+	assert.Equal(t, uint16(0x2004), anlz.ColorColumn(1, 0, 0, 1))
+}
@@ -0,0 +1,37 @@
+package anlz
+
+import (
+	`bytes`
+	`encoding/binary`
+)
+
+type BeatGridHeader struct {
+	Unknown1 uint32 // Always zero
+	Unknown2 uint32 // Always 0x00080000
+	LenBeats uint32
+}
+
+type Beat struct {
+	BeatNumber uint16 // Position within the bar, 1-4.
+	Tempo      uint16 // Beats per minute, multiplied by 100.
+	Time       uint32 // Milliseconds since the start of the track.
+}
+
+/**
+ * PQTZ section, holding the beat grid of a track.
+ */
+type BeatGrid struct {
+	Beats []Beat
+}
+
+func (bg *BeatGrid) MarshalBinary() ([]byte, error) {
+	body := &bytes.Buffer{}
+	err := binary.Write(body, binary.BigEndian, bg.Beats)
+	if err != nil {
+		return nil, err
+	}
+	return marshalSection("PQTZ", BeatGridHeader{
+		Unknown2: 0x80000,
+		LenBeats: uint32(len(bg.Beats)),
+	}, body.Bytes())
+}
@@ -0,0 +1,196 @@
+package anlz
+
+import (
+	`bytes`
+	`encoding/binary`
+	`unicode/utf16`
+)
+
+type CueListType uint32
+
+const (
+	CueListMemory  CueListType = 0
+	CueListHotCues CueListType = 1
+)
+
+type CueType uint8
+
+const (
+	CueTypePoint CueType = 1
+	CueTypeLoop  CueType = 2
+)
+
+// Used in the linked list of cue entries, and for loop times of cue points.
+const noEntry = 0xffff
+const noLoop = 0xffffffff
+
+// A single hot cue or memory cue.
+type Cue struct {
+	HotCue   uint32 // Zero for memory cues, 1 for hot cue A, 2 for B, etc.
+	Type     CueType
+	Time     uint32 // Milliseconds since the start of the track.
+	LoopTime uint32 // End of loop in milliseconds, only for loops.
+	Comment  string
+	Red      uint8
+	Green    uint8
+	Blue     uint8
+}
+
+type CueListHeader struct {
+	Type        CueListType
+	Unknown1    uint16 // Always zero
+	NumCues     uint16
+	MemoryCount uint32 // Number of memory cues, or 0xffffffff for hot cue lists.
+}
+
+type CueEntryHeader struct {
+	HotCue     uint32
+	Status     uint32 // 0 = disabled, 1 = enabled
+	Unknown1   uint32 // Always 0x00010000
+	OrderFirst uint16 // Previous entry in the list, or 0xffff.
+	OrderLast  uint16 // Next entry in the list, or 0xffff.
+}
+
+type CueEntryBody struct {
+	Type     CueType
+	Unknown1 uint8  // Always zero
+	Unknown2 uint16 // Always 0x03e8
+	Time     uint32
+	LoopTime uint32
+	Unknown3 [16]byte
+}
+
+/**
+ * PCOB section, holding either hot cues or memory cues.
+ * Found in the .DAT file, and used by older players.
+ */
+type CueList struct {
+	Type CueListType
+	Cues []Cue
+}
+
+func (cl *CueList) MarshalBinary() ([]byte, error) {
+	body := &bytes.Buffer{}
+	for i, cue := range cl.Cues {
+		header := CueEntryHeader{
+			HotCue:     cue.HotCue,
+			Status:     1,
+			Unknown1:   0x10000,
+			OrderFirst: noEntry,
+			OrderLast:  noEntry,
+		}
+		if i > 0 {
+			header.OrderFirst = uint16(i - 1)
+		}
+		if i+1 < len(cl.Cues) {
+			header.OrderLast = uint16(i + 1)
+		}
+		entry := CueEntryBody{
+			Type:     cue.Type,
+			Unknown2: 0x3e8,
+			Time:     cue.Time,
+			LoopTime: cue.LoopTime,
+		}
+		if cue.Type != CueTypeLoop {
+			entry.LoopTime = noLoop
+		}
+		data, err := marshalSection("PCPT", header, marshalBigEndian(entry))
+		if err != nil {
+			return nil, err
+		}
+		body.Write(data)
+	}
+
+	header := CueListHeader{
+		Type:        cl.Type,
+		NumCues:     uint16(len(cl.Cues)),
+		MemoryCount: uint32(len(cl.Cues)),
+	}
+	if cl.Type == CueListHotCues {
+		header.MemoryCount = noLoop
+	}
+
+	return marshalSection("PCOB", header, body.Bytes())
+}
+
+type ExtendedCueListHeader struct {
+	Type     CueListType
+	NumCues  uint16
+	Unknown1 uint16 // Always zero
+}
+
+type ExtendedCueEntryHeader struct {
+	HotCue uint32
+}
+
+type ExtendedCueEntryBody struct {
+	Type            CueType
+	Unknown1        [3]byte
+	Time            uint32
+	LoopTime        uint32
+	ColorId         uint8
+	Unknown2        [7]byte
+	LoopNumerator   uint16
+	LoopDenominator uint16
+	LenComment      uint32
+}
+
+type ExtendedCueEntryColor struct {
+	ColorCode uint8
+	Red       uint8
+	Green     uint8
+	Blue      uint8
+}
+
+/**
+ * PCO2 section, holding hot cues or memory cues with comments and colors.
+ * Found in the .EXT file, and used by newer players.
+ */
+type ExtendedCueList struct {
+	Type CueListType
+	Cues []Cue
+}
+
+func (cl *ExtendedCueList) MarshalBinary() ([]byte, error) {
+	body := &bytes.Buffer{}
+	for _, cue := range cl.Cues {
+		comment := []uint16{}
+		if len(cue.Comment) > 0 {
+			comment = append(utf16.Encode([]rune(cue.Comment)), 0)
+		}
+		entry := ExtendedCueEntryBody{
+			Type:       cue.Type,
+			Time:       cue.Time,
+			LoopTime:   cue.LoopTime,
+			LenComment: uint32(len(comment) * 2),
+		}
+		if cue.Type != CueTypeLoop {
+			entry.LoopTime = noLoop
+		}
+		entryBody := &bytes.Buffer{}
+		entryBody.Write(marshalBigEndian(entry))
+		entryBody.Write(marshalBigEndian(comment))
+		entryBody.Write(marshalBigEndian(ExtendedCueEntryColor{
+			Red:   cue.Red,
+			Green: cue.Green,
+			Blue:  cue.Blue,
+		}))
+		data, err := marshalSection("PCP2", ExtendedCueEntryHeader{HotCue: cue.HotCue}, entryBody.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		body.Write(data)
+	}
+
+	return marshalSection("PCO2", ExtendedCueListHeader{
+		Type:    cl.Type,
+		NumCues: uint16(len(cl.Cues)),
+	}, body.Bytes())
+}
+
+// Writing fixed-size data to a bytes.Buffer never fails.
+func marshalBigEndian(data any) []byte {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.BigEndian, data)
+	return buf.Bytes()
+}
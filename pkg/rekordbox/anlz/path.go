@@ -0,0 +1,53 @@
+package anlz
+
+import (
+	`bytes`
+	`encoding/binary`
+	`fmt`
+	`unicode/utf16`
+)
+
+const (
+	DatFilename = "ANLZ0000.DAT"
+	ExtFilename = "ANLZ0000.EXT"
+)
+
+// Returns the directory, relative to the media root, where analysis files for a track are stored.
+// Rekordbox uses a hash of the track's path to spread files across directories, e.g.
+// /PIONEER/USBANLZ/P016/0000875E. Players only follow the path stored in the track row,
+// so the directory is named after the track ID instead, which is unique within the export.
+// Up to 256 tracks share a parent directory.
+func Dir(trackID uint32) string {
+	return fmt.Sprintf("/PIONEER/USBANLZ/P%03X/%08X", trackID>>8, trackID)
+}
+
+// Path of the .DAT analysis file, as stored in the track row.
+func Path(trackID uint32) string {
+	return Dir(trackID) + "/" + DatFilename
+}
+
+// Path of the extended .EXT analysis file.
+func ExtPath(trackID uint32) string {
+	return Dir(trackID) + "/" + ExtFilename
+}
+
+type PathHeader struct {
+	LenPath uint32
+}
+
+/**
+ * PPTH section, holding the path of the audio file this analysis belongs to.
+ */
+type PathSection struct {
+	Path string
+}
+
+func (p *PathSection) MarshalBinary() ([]byte, error) {
+	body := &bytes.Buffer{}
+	runes := append(utf16.Encode([]rune(p.Path)), 0)
+	err := binary.Write(body, binary.BigEndian, runes)
+	if err != nil {
+		return nil, err
+	}
+	return marshalSection("PPTH", PathHeader{LenPath: uint32(body.Len())}, body.Bytes())
+}
@@ -0,0 +1,128 @@
+package anlz
+
+import (
+	`bytes`
+	`encoding/binary`
+)
+
+// Waveform details have 150 entries per second of audio.
+const WaveformDetailRate = 150
+
+// Fixed number of columns in the different waveform previews.
+const (
+	WaveformPreviewLength      = 400
+	TinyWaveformPreviewLength  = 100
+	ColorWaveformPreviewLength = 1200
+)
+
+type WaveformPreviewHeader struct {
+	LenPreview uint32
+	Unknown1   uint32 // Always 0x00010000
+}
+
+type WaveformHeader struct {
+	LenEntryBytes uint32
+	LenEntries    uint32
+	Unknown1      uint32
+}
+
+/**
+ * PWAV section, a monochrome waveform preview of the whole track.
+ * Every byte is a column, where the low five bits is the height,
+ * and the high three bits is the whiteness of the column.
+ */
+type WaveformPreview struct {
+	Data []byte
+}
+
+func (w *WaveformPreview) MarshalBinary() ([]byte, error) {
+	return marshalSection("PWAV", WaveformPreviewHeader{
+		LenPreview: uint32(len(w.Data)),
+		Unknown1:   0x10000,
+	}, w.Data)
+}
+
+/**
+ * PWV2 section, a tiny monochrome waveform preview used by the CDJ-900.
+ * Every byte is a column, where the low four bits is the height.
+ */
+type TinyWaveformPreview struct {
+	Data []byte
+}
+
+func (w *TinyWaveformPreview) MarshalBinary() ([]byte, error) {
+	return marshalSection("PWV2", WaveformPreviewHeader{
+		LenPreview: uint32(len(w.Data)),
+		Unknown1:   0x10000,
+	}, w.Data)
+}
+
+/**
+ * PWV3 section, the scrolling monochrome waveform.
+ * Encoded the same way as the preview, but with one byte per half frame (1/150th second).
+ */
+type WaveformDetail struct {
+	Data []byte
+}
+
+func (w *WaveformDetail) MarshalBinary() ([]byte, error) {
+	return marshalSection("PWV3", WaveformHeader{
+		LenEntryBytes: 1,
+		LenEntries:    uint32(len(w.Data)),
+		Unknown1:      0x960000,
+	}, w.Data)
+}
+
+/**
+ * PWV4 section, the color waveform preview.
+ * There are six bytes per column. The last three bytes are the heights of
+ * the red, green and blue components, which are blended into the column color.
+ * The first three bytes are not fully understood; we fill them with the overall height.
+ */
+type ColorWaveformPreview struct {
+	Data [][6]byte
+}
+
+func (w *ColorWaveformPreview) MarshalBinary() ([]byte, error) {
+	body := &bytes.Buffer{}
+	err := binary.Write(body, binary.BigEndian, w.Data)
+	if err != nil {
+		return nil, err
+	}
+	return marshalSection("PWV4", WaveformHeader{
+		LenEntryBytes: 6,
+		LenEntries:    uint32(len(w.Data)),
+	}, body.Bytes())
+}
+
+/**
+ * PWV5 section, the scrolling color waveform.
+ * Each entry is a bitfield of three bits red, three bits green, three bits blue,
+ * and five bits of height, with the two least significant bits unused.
+ */
+type ColorWaveformDetail struct {
+	Data []uint16
+}
+
+func (w *ColorWaveformDetail) MarshalBinary() ([]byte, error) {
+	body := &bytes.Buffer{}
+	err := binary.Write(body, binary.BigEndian, w.Data)
+	if err != nil {
+		return nil, err
+	}
+	return marshalSection("PWV5", WaveformHeader{
+		LenEntryBytes: 2,
+		LenEntries:    uint32(len(w.Data)),
+		Unknown1:      0x960305,
+	}, body.Bytes())
+}
+
+// Encode a column of the monochrome waveforms.
+func MonochromeColumn(height, whiteness uint8) byte {
+	return (whiteness&0x7)<<5 | height&0x1f
+}
+
+// Encode an entry of the color waveform detail.
+func ColorColumn(red, green, blue, height uint8) uint16 {
+	return uint16(red&0x7)<<13 | uint16(green&0x7)<<10 | uint16(blue&0x7)<<7 | uint16(height&0x1f)<<2
+}
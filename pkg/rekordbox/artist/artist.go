@@ -2,6 +2,8 @@ package artist
 
 import (
 	`bytes`
+	`encoding/binary`
+	`io`
 
 	`github.com/ambientsound/rex/pkg/marshal`
 	`github.com/ambientsound/rex/pkg/rekordbox/dstring`
@@ -35,6 +37,34 @@ func (artist *Artist) MarshalBinary() ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+func (artist *Artist) UnmarshalBinary(data []byte) error {
+	const headerSize = 10
+	if len(data) < headerSize {
+		return io.ErrShortBuffer
+	}
+	artist.Subtype = binary.LittleEndian.Uint16(data[0:])
+	artist.IndexShift = binary.LittleEndian.Uint16(data[2:])
+	artist.Id = binary.LittleEndian.Uint32(data[4:])
+	artist.Unnamed3 = data[8]
+	artist.OfsNameNear = data[9]
+
+	// Subtype 0x64 means that the name is too far away for a single byte offset.
+	offset := int(artist.OfsNameNear)
+	if artist.Subtype == 0x64 {
+		if len(data) < headerSize+2 {
+			return io.ErrShortBuffer
+		}
+		offset = int(binary.LittleEndian.Uint16(data[headerSize:]))
+	}
+	if offset >= len(data) {
+		return io.ErrShortBuffer
+	}
+
+	var err error
+	artist.Name, err = dstring.UnmarshalBinary(data[offset:])
+	return err
+}
+
 func (artist *Artist) SetIndexShift(shift uint16) {
 	artist.IndexShift = shift
 }
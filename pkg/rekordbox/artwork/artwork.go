@@ -0,0 +1,60 @@
+package artwork
+
+import (
+	`bytes`
+	`fmt`
+	`strings`
+
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox/dstring`
+)
+
+// Pixel sizes of the square images stored for each artwork.
+// Players show the thumbnail in track lists, and the medium size on the track screen.
+const (
+	ThumbnailSize = 80
+	MediumSize    = 240
+)
+
+/**
+ * A row that holds the path to an artwork image and the associated ID.
+ * The path points to the thumbnail, e.g. /PIONEER/Artwork/00001/a1.jpg;
+ * the medium size image is stored next to it, e.g. /PIONEER/Artwork/00001/a1_m.jpg.
+ */
+type Artwork struct {
+	Id   uint32
+	Path string
+}
+
+// Path of the thumbnail image of an artwork, relative to the media root.
+func Path(id uint32) string {
+	return fmt.Sprintf("/PIONEER/Artwork/00001/a%d.jpg", id)
+}
+
+// Path of the medium size image, derived from the thumbnail path.
+func MediumPath(path string) string {
+	return strings.TrimSuffix(path, ".jpg") + "_m.jpg"
+}
+
+func (artwork *Artwork) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := marshal.PackInto(buf, &artwork.Id)
+	if err != nil {
+		return nil, err
+	}
+	pathEncoder := dstring.New(artwork.Path)
+	err = marshal.Into(buf, pathEncoder)
+	return buf.Bytes(), err
+}
+
+func (artwork *Artwork) UnmarshalBinary(data []byte) error {
+	err := marshal.Unpack(&artwork.Id, data)
+	if err != nil {
+		return err
+	}
+	artwork.Path, err = dstring.UnmarshalBinary(data[4:])
+	return err
+}
+
+func (artwork *Artwork) SetIndexShift(shift uint16) {
+}
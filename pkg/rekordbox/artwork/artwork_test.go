@@ -0,0 +1,39 @@
+package artwork_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/artwork`
+	`github.com/stretchr/testify/assert`
+)
+
+var artworkRow = []byte{
+	0x01, 0x00, 0x00, 0x00, 0x3d,
+	0x2f, 0x50, 0x49, 0x4f, 0x4e, 0x45, 0x45, 0x52, 0x2f, 0x41, 0x72, 0x74, 0x77, 0x6f, 0x72,
+	0x6b, 0x2f, 0x30, 0x30, 0x30, 0x30, 0x31, 0x2f, 0x61, 0x31, 0x2e, 0x6a, 0x70, 0x67,
+}
+
+func TestArtwork_MarshalBinary(t *testing.T) {
+	a := artwork.Artwork{
+		Id:   1,
+		Path: artwork.Path(1),
+	}
+
+	data, err := a.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, artworkRow, data)
+}
+
+func TestArtwork_UnmarshalBinary(t *testing.T) {
+	a := &artwork.Artwork{}
+	err := a.UnmarshalBinary(artworkRow)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), a.Id)
+	assert.Equal(t, "/PIONEER/Artwork/00001/a1.jpg", a.Path)
+}
+
+func TestMediumPath(t *testing.T) {
+	assert.Equal(t, "/PIONEER/Artwork/00001/a12_m.jpg", artwork.MediumPath(artwork.Path(12)))
+}
@@ -0,0 +1,97 @@
+package color
+
+import (
+	`fmt`
+	`strconv`
+	`strings`
+)
+
+// Approximate RGB values of the track colors, as shown by rekordbox, keyed by color ID.
+var RGB = map[uint16]uint32{
+	1: 0xf870f8, // Pink
+	2: 0xf8212a, // Red
+	3: 0xf8a030, // Orange
+	4: 0xf8e331, // Yellow
+	5: 0x10b176, // Green
+	6: 0x1cc5e6, // Aqua
+	7: 0x0050f8, // Blue
+	8: 0x9808f8, // Purple
+}
+
+// Maps RGB values to color IDs.
+// Values not found in the mapping are matched to the nearest track color.
+type Mapping map[uint32]uint16
+
+// Returns the color ID for an RGB value.
+func (m Mapping) ID(rgb uint32) uint16 {
+	id, found := m[rgb]
+	if found {
+		return id
+	}
+	return Nearest(rgb)
+}
+
+// Returns the ID of the track color closest to an RGB value.
+func Nearest(rgb uint32) uint16 {
+	var nearest uint16
+	minDistance := -1
+	for _, c := range InitialDataset {
+		distance := rgbDistance(rgb, RGB[c.ID])
+		if minDistance < 0 || distance < minDistance {
+			nearest = c.ID
+			minDistance = distance
+		}
+	}
+	return nearest
+}
+
+// Squared euclidean distance between two RGB values.
+func rgbDistance(a, b uint32) int {
+	distance := 0
+	for shift := 0; shift < 24; shift += 8 {
+		d := int(a>>shift&0xff) - int(b>>shift&0xff)
+		distance += d * d
+	}
+	return distance
+}
+
+// Returns the ID of a track color by its name, e.g. "Aqua".
+// The name "none" gives ID zero, which means no color.
+func IDFromName(name string) (uint16, error) {
+	if strings.EqualFold(name, "none") {
+		return 0, nil
+	}
+	for _, c := range InitialDataset {
+		if strings.EqualFold(c.Name, name) {
+			return c.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown color '%s'", name)
+}
+
+// Parse a comma separated list of RGB values mapped to color names,
+// e.g. "#ff0000=Red,00ff00=Green".
+func ParseMapping(s string) (Mapping, error) {
+	m := make(Mapping)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		rgbString, name, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid color mapping '%s', expected RRGGBB=Name", item)
+		}
+		rgbString = strings.TrimPrefix(strings.TrimSpace(rgbString), "#")
+		rgb, err := strconv.ParseUint(rgbString, 16, 24)
+		if err != nil {
+			return nil, fmt.Errorf("invalid color mapping '%s': %w", item, err)
+		}
+		id, err := IDFromName(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		m[uint32(rgb)] = id
+	}
+	return m, nil
+}
@@ -0,0 +1,37 @@
+package color_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestNearest(t *testing.T) {
+	assert.Equal(t, uint16(2), color.Nearest(0xff0000))
+	assert.Equal(t, uint16(5), color.Nearest(0x00ff00))
+	assert.Equal(t, uint16(7), color.Nearest(0x0000ff))
+	assert.Equal(t, uint16(6), color.Nearest(0x00ffff))
+
+	// Every track color is matched to itself.
+	for id, rgb := range color.RGB {
+		assert.Equal(t, id, color.Nearest(rgb))
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	m, err := color.ParseMapping("#ff0000=purple, 00ff00=None")
+	assert.NoError(t, err)
+	assert.Equal(t, color.Mapping{0xff0000: 8, 0x00ff00: 0}, m)
+
+	assert.Equal(t, uint16(8), m.ID(0xff0000))
+	assert.Equal(t, uint16(0), m.ID(0x00ff00))
+	assert.Equal(t, uint16(7), m.ID(0x0000ff))
+
+	_, err = color.ParseMapping("ff0000")
+	assert.Error(t, err)
+	_, err = color.ParseMapping("ff0000=Brown")
+	assert.Error(t, err)
+	_, err = color.ParseMapping("red=Red")
+	assert.Error(t, err)
+}
@@ -3,22 +3,44 @@ package dbengine
 import (
 	`bytes`
 	`encoding`
+	`errors`
+	`fmt`
 	`io`
 
 	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox`
 	`github.com/ambientsound/rex/pkg/rekordbox/page`
 	`github.com/ambientsound/rex/pkg/rekordbox/pdb`
 )
 
 const emptyTable = 0x03ffffff
 
+// Returned when a table needs more pages than its index page can list, and overflow indexes are not enabled.
+var ErrIndexFull = errors.New("table index is full")
+
 type DbEngine struct {
 	Globals *pdb.FileHeader
+
+	// Continue full table indexes on overflow index pages, linked from the last index page.
+	// This is rex's own convention, and it is not known whether the players follow these links,
+	// so it must be enabled explicitly. Otherwise, adding a page to a full index returns ErrIndexFull.
+	OverflowIndexes bool
+
 	tables  []*page.Index
-	indices map[page.Type]*page.Index
+	indices map[page.Type][]*page.Index // The first index page of each table, followed by its overflow pages.
+	indexed map[page.Type]bool          // Tables whose index is kept up to date, see maintainsIndex.
+	pending map[page.Type]*pendingPage
 	backend io.ReadWriteSeeker
 }
 
+// The last data page of a table, kept in memory while rows are inserted.
+// Pages that already exist in the database file are marked as allocated,
+// and are written back in place.
+type pendingPage struct {
+	data      *page.Data
+	allocated bool
+}
+
 func New(dbFile io.ReadWriteSeeker) *DbEngine {
 	return &DbEngine{
 		Globals: &pdb.FileHeader{
@@ -28,11 +50,17 @@ func New(dbFile io.ReadWriteSeeker) *DbEngine {
 			Unknown1:       0x5,
 		},
 		tables:  make([]*page.Index, 0),
-		indices: make(map[page.Type]*page.Index),
+		indices: make(map[page.Type][]*page.Index),
+		indexed: make(map[page.Type]bool),
+		pending: make(map[page.Type]*pendingPage),
 		backend: dbFile,
 	}
 }
 
+// Open an existing database file.
+// Rows can be appended to the tables using InsertRow.
+// Only the file header is read here, and tables are read when they are used,
+// so that damaged files can still be opened and inspected.
 func Open(dbFile io.ReadWriteSeeker) (*DbEngine, error) {
 	db := New(dbFile)
 	err := db.seekToPage(0)
@@ -40,7 +68,11 @@ func Open(dbFile io.ReadWriteSeeker) (*DbEngine, error) {
 		return nil, err
 	}
 	err = marshal.UnpackFrom(db.backend, db.Globals)
-	return db, err
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
 }
 
 func (db *DbEngine) WriteHeader() error {
@@ -78,7 +110,8 @@ func (db *DbEngine) CreateTable(pageType page.Type) error {
 		return err
 	}
 
-	db.indices[pageType] = p
+	db.indices[pageType] = []*page.Index{p}
+	db.indexed[pageType] = true
 
 	// Update database state
 	ptr := pdb.TablePointer{
@@ -99,24 +132,268 @@ func (db *DbEngine) InsertPage(p *page.Data) error {
 	p.NextPage = db.Globals.NextUnusedPage
 	p.Transaction = db.Globals.Sequence
 
-	err := db.writeBlock(p.PageIndex, p)
+	// The next page of the table is reserved here,
+	// so that index pages can be allocated after it.
+	db.Globals.NextUnusedPage++
+
+	err := db.updateIndex(p)
 	if err != nil {
 		return err
 	}
 
-	err = db.updateIndex(p.Type)
+	err = db.writeBlock(p.PageIndex, p)
 	if err != nil {
 		return err
 	}
 
 	// Update database state
-	db.Globals.NextUnusedPage++
 	db.Globals.Sequence++
 	db.setTableLimits(p.Type, p.PageIndex, p.NextPage)
 
 	return db.WriteHeader()
 }
 
+// Insert a row into a table. Rows are added to the last page of the table
+// until it is full, and then a new page is allocated.
+// Call Commit to write the remaining pages to disk.
+func (db *DbEngine) InsertRow(pageType page.Type, row page.Row) error {
+	pending, err := db.pendingPage(pageType)
+	if err != nil {
+		return err
+	}
+
+	err = pending.data.Insert(row)
+	if err != io.ErrShortWrite {
+		return err
+	}
+
+	err = db.flush(pageType)
+	if err != nil {
+		return err
+	}
+
+	pending = &pendingPage{
+		data: page.NewPage(pageType),
+	}
+	db.pending[pageType] = pending
+
+	return pending.data.Insert(row)
+}
+
+// Mark the row with the given ID as deleted.
+func (db *DbEngine) DeleteRow(pageType page.Type, id uint32) error {
+	pg, rowIndex, err := db.findRow(pageType, id)
+	if err != nil {
+		return err
+	}
+
+	err = pg.Delete(rowIndex)
+	if err != nil {
+		return err
+	}
+
+	return db.rewritePage(pg)
+}
+
+// Mark all rows for which match returns true as deleted.
+// This also works for tables without row IDs, such as playlist entries.
+// T is the row type registered for the table. Returns the number of deleted rows.
+func DeleteRows[T any](db *DbEngine, pageType page.Type, match func(row *T) bool) (int, error) {
+	// Rows that are not yet written to disk can not be found otherwise.
+	err := db.flush(pageType)
+	if err != nil {
+		return 0, err
+	}
+
+	table, err := db.GetTable(pageType)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for i := range table.Pages {
+		pg := &table.Pages[i]
+		changed := false
+		for rowIndex, rowref := range pg.HeapPositions() {
+			if !rowref.Exists {
+				continue
+			}
+			data := rekordbox.NewRow(pageType)
+			row, ok := any(data).(*T)
+			if !ok {
+				return deleted, fmt.Errorf("unexpected row type %T in table '%s'", data, pageType)
+			}
+			err = pg.UnmarshalRow(data, rowref.HeapPosition)
+			if err != nil {
+				return deleted, err
+			}
+			if !match(row) {
+				continue
+			}
+			err = pg.Delete(rowIndex)
+			if err != nil {
+				return deleted, err
+			}
+			changed = true
+			deleted++
+		}
+		if changed {
+			err = db.rewritePage(pg)
+			if err != nil {
+				return deleted, err
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+// Replace the row with the given ID.
+// If the page holding the row is full, the row is deleted from that page
+// and inserted at the end of the table. Call Commit to write it to disk.
+func (db *DbEngine) UpdateRow(pageType page.Type, id uint32, row page.Row) error {
+	pg, rowIndex, err := db.findRow(pageType, id)
+	if err != nil {
+		return err
+	}
+
+	err = pg.Update(rowIndex, row)
+	if err == nil {
+		return db.rewritePage(pg)
+	} else if err != io.ErrShortWrite {
+		return err
+	}
+
+	err = pg.Delete(rowIndex)
+	if err != nil {
+		return err
+	}
+
+	err = db.rewritePage(pg)
+	if err != nil {
+		return err
+	}
+
+	return db.InsertRow(pageType, row)
+}
+
+// Write all pages with inserted rows to disk.
+func (db *DbEngine) Commit() error {
+	for _, ptr := range db.Globals.Pointers {
+		err := db.flush(ptr.Type)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the page where new rows are inserted.
+// For tables that already contain data, this is the last page in the table.
+func (db *DbEngine) pendingPage(pageType page.Type) (*pendingPage, error) {
+	pending := db.pending[pageType]
+	if pending != nil {
+		return pending, nil
+	}
+
+	ptr, err := db.tablePointer(pageType)
+	if err != nil {
+		return nil, err
+	}
+
+	pending = &pendingPage{
+		data: page.NewPage(pageType),
+	}
+
+	if ptr.LastPage != ptr.FirstPage {
+		table, err := db.GetTable(pageType)
+		if err != nil {
+			return nil, err
+		}
+		if len(table.Pages) > 0 {
+			pending.data = &table.Pages[len(table.Pages)-1]
+			pending.allocated = true
+		}
+	}
+
+	db.pending[pageType] = pending
+
+	return pending, nil
+}
+
+func (db *DbEngine) flush(pageType page.Type) error {
+	pending := db.pending[pageType]
+	if pending == nil {
+		return nil
+	}
+	delete(db.pending, pageType)
+	if pending.allocated {
+		return db.rewritePage(pending.data)
+	}
+	return db.InsertPage(pending.data)
+}
+
+// Write an existing page back to its original position.
+func (db *DbEngine) rewritePage(p *page.Data) error {
+	p.Transaction = db.Globals.Sequence
+
+	err := db.writeBlock(p.PageIndex, p)
+	if err != nil {
+		return err
+	}
+
+	db.Globals.Sequence++
+
+	return db.WriteHeader()
+}
+
+// Find the page and row index of the row with the given ID.
+func (db *DbEngine) findRow(pageType page.Type, id uint32) (*page.Data, int, error) {
+	offset, ok := rowIDOffsets[pageType]
+	if !ok {
+		return nil, 0, fmt.Errorf("table '%s' has no row IDs", pageType)
+	}
+
+	// Rows that are not yet written to disk can not be found otherwise.
+	err := db.flush(pageType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	table, err := db.GetTable(pageType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range table.Pages {
+		pg := &table.Pages[i]
+		for rowIndex, rowref := range pg.HeapPositions() {
+			if !rowref.Exists {
+				continue
+			}
+			row := &rowID{offset: offset}
+			err = pg.UnmarshalRow(row, rowref.HeapPosition)
+			if err != nil {
+				return nil, 0, err
+			}
+			if row.id == id {
+				return pg, rowIndex, nil
+			}
+		}
+	}
+
+	return nil, 0, fmt.Errorf("%s id %d: %w", pageType, id, page.ErrRowNotFound)
+}
+
+func (db *DbEngine) tablePointer(pageType page.Type) (*pdb.TablePointer, error) {
+	for i := range db.Globals.Pointers {
+		if db.Globals.Pointers[i].Type == pageType {
+			return &db.Globals.Pointers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("table '%s' not found", pageType)
+}
+
 func (db *DbEngine) nextFreePage(pageType page.Type) uint32 {
 	for _, ptr := range db.Globals.Pointers {
 		if ptr.Type != pageType {
@@ -127,13 +404,135 @@ func (db *DbEngine) nextFreePage(pageType page.Type) uint32 {
 	panic("table does not exist")
 }
 
-func (db *DbEngine) updateIndex(pageType page.Type) error {
-	index := db.indices[pageType]
-	if index == nil {
-		panic("table does not exist")
+// Add a new data page to the index of its table, and write the index.
+// When the last index page is full, a new index page is allocated and linked from it,
+// if overflow indexes are enabled.
+// Indexed data pages are flagged as such.
+//
+// Only tables with more than one data page are indexed. In rekordbox exports,
+// the single data pages of small tables such as COLORS and COLUMNS are flagged 0x24,
+// and their index is empty. When the second data page is added, the first one is indexed too.
+// Tables whose index rex does not maintain only get the new page linked from the index page.
+func (db *DbEngine) updateIndex(p *page.Data) error {
+	indices, err := db.tableIndex(p.Type)
+	if err != nil {
+		return err
+	}
+	first := indices[0]
+	last := indices[len(indices)-1]
+
+	// The first index page points to the first data page.
+	if first.IndexHeader.NextPage == emptyTable {
+		first.IndexHeader.NextPage = first.Header.NextPage
+		return db.writeBlock(first.Header.PageIndex, first)
+	}
+
+	maintained, err := db.maintainsIndex(p.Type)
+	if err != nil || !maintained {
+		return err
+	}
+
+	if len(first.IndexEntries) == 0 {
+		err = db.indexFirstPage(first)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.PageFlags = page.FlagsDataIndexed
+	if last.AddEntry(p.PageIndex) {
+		return db.writeBlock(last.Header.PageIndex, last)
+	}
+
+	if !db.OverflowIndexes {
+		return fmt.Errorf("table '%s' has more than %d pages: %w", p.Type, len(indices)*page.IndexCapacity, ErrIndexFull)
+	}
+
+	overflow := page.NewIndex(p.Type)
+	overflow.Header.PageIndex = db.Globals.NextUnusedPage
+	overflow.Header.NextPage = emptyTable
+	overflow.IndexHeader.NextPage = emptyTable
+	overflow.Header.Transaction = 1
+	overflow.AddEntry(p.PageIndex)
+	db.Globals.NextUnusedPage++
+
+	err = db.writeBlock(overflow.Header.PageIndex, overflow)
+	if err != nil {
+		return err
+	}
+
+	last.IndexHeader.NextIndexPage = overflow.Header.PageIndex
+	db.indices[p.Type] = append(indices, overflow)
+
+	return db.writeBlock(last.Header.PageIndex, last)
+}
+
+// The index page of a table, followed by its overflow pages.
+// Index pages are read from the file the first time they are needed.
+func (db *DbEngine) tableIndex(pageType page.Type) ([]*page.Index, error) {
+	indices, found := db.indices[pageType]
+	if found {
+		return indices, nil
+	}
+	ptr, err := db.tablePointer(pageType)
+	if err != nil {
+		return nil, err
+	}
+	indices, err = db.readIndexChain(ptr.FirstPage)
+	if err != nil {
+		return nil, fmt.Errorf("read index of table '%s': %w", pageType, err)
+	}
+	db.indices[pageType] = indices
+	return indices, nil
+}
+
+// Returns true if rex keeps the index of a table up to date.
+// The encoding of index entries is a guess, so only indexes that rex wrote itself are maintained:
+// those of tables created with CreateTable, and those that already list every data page of the table
+// in that encoding. Other tables, such as multi-page tables that rekordbox left unindexed,
+// keep their index as it is.
+func (db *DbEngine) maintainsIndex(pageType page.Type) (bool, error) {
+	indexed, found := db.indexed[pageType]
+	if found {
+		return indexed, nil
+	}
+	table, err := db.GetTable(pageType)
+	if err != nil {
+		return false, err
+	}
+	entries := table.Index.IndexEntries
+	for _, overflow := range table.Overflow {
+		entries = append(entries, overflow.IndexEntries...)
+	}
+	indexed = len(entries) > 0 && len(entries) == len(table.Pages)
+	for i := 0; indexed && i < len(entries); i++ {
+		indexed = entries[i] == page.IndexEntry(table.Pages[i].PageIndex)
+	}
+	db.indexed[pageType] = indexed
+	return indexed, nil
+}
+
+// Add the first data page of a table to its index, and flag it as indexed.
+// The page is already written, so it is read back and written again.
+func (db *DbEngine) indexFirstPage(index *page.Index) error {
+	pageIndex := index.IndexHeader.NextPage
+	err := db.seekToPage(pageIndex)
+	if err != nil {
+		return err
+	}
+	data, err := db.readData()
+	if err != nil {
+		return err
+	}
+
+	data.PageFlags = page.FlagsDataIndexed
+	err = db.writeBlock(pageIndex, data)
+	if err != nil {
+		return err
 	}
-	index.IndexHeader.NextPage = index.Header.NextPage
-	return db.writeBlock(index.Header.PageIndex, index)
+
+	index.AddEntry(pageIndex)
+	return nil
 }
 
 func (db *DbEngine) setTableLimits(pageType page.Type, lastPage uint32, emptyCandidate uint32) {
@@ -176,38 +575,3 @@ func (db *DbEngine) parseIndexPage(header page.Header) (p *page.Index, err error
 		IndexHeader: *idx,
 	}, nil
 }
-
-func (db *DbEngine) parseDataPage(header page.Header) (p *page.Data, err error) {
-	switch header.Type {
-	case page.Type_Tracks:
-	case page.Type_Genres:
-	case page.Type_Artists:
-	case page.Type_Albums:
-	case page.Type_Labels:
-	case page.Type_Keys:
-	case page.Type_Colors:
-	case page.Type_PlaylistTree:
-	case page.Type_PlaylistEntries:
-	case page.Type_Unknown9:
-	case page.Type_Unknown10:
-	case page.Type_HistoryPlaylists:
-	case page.Type_HistoryEntries:
-	case page.Type_Artwork:
-	case page.Type_Unknown14:
-	case page.Type_Unknown15:
-	case page.Type_Columns:
-	case page.Type_Unknown17:
-	case page.Type_Unknown18:
-	case page.Type_History:
-	}
-
-	data := &page.DataHeader{}
-	err = marshal.UnpackFrom(db.backend, data)
-	if err != nil {
-		return
-	}
-	return &page.Data{
-		Header:     header,
-		DataHeader: *data,
-	}, nil
-}
@@ -1,11 +1,23 @@
 package dbengine_test
 
 import (
+	`fmt`
 	`os`
+	`path/filepath`
+	`strings`
 	`testing`
 
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/ambientsound/rex/pkg/rekordbox/column`
 	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine/dbtest`
+	`github.com/ambientsound/rex/pkg/rekordbox/genre`
 	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/playlist`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+	`github.com/ambientsound/rex/pkg/rekordbox/unknown17`
+	`github.com/ambientsound/rex/pkg/rekordbox/unknown18`
+	`github.com/ambientsound/rex/pkg/rekordbox/verify`
 	`github.com/stretchr/testify/assert`
 )
 
@@ -21,10 +33,499 @@ func TestDbEngine_WriteHeader(t *testing.T) {
 	assert.NoError(t, db.CreateTable(page.Type_Tracks))
 	assert.NoError(t, db.CreateTable(page.Type_Genres))
 
-	p := page.NewPage(page.Type_Tracks, page.TypicalPageSize)
+	p := page.NewPage(page.Type_Tracks)
 	assert.NoError(t, db.InsertPage(p))
 	assert.NoError(t, db.InsertPage(p))
 	assert.NoError(t, db.InsertPage(p))
 
 	assert.NoError(t, db.CreateTable(page.Type_Artists))
 }
+
+// Rows inserted after reopening a database must be appended to the last page
+// of the table, and continue onto new pages when the last page is full.
+func TestDbEngine_InsertRow_Reopen(t *testing.T) {
+	insert := func(db *dbengine.DbEngine, from, to int) {
+		for i := from; i < to; i++ {
+			row := &color.Color{
+				Header: color.Header{ID: uint16(i)},
+				Name:   fmt.Sprintf("Color number %d", i),
+			}
+			assert.NoError(t, db.InsertRow(page.Type_Colors, row))
+		}
+		assert.NoError(t, db.Commit())
+	}
+
+	rows := func(db *dbengine.DbEngine) []uint16 {
+		table, err := db.GetTable(page.Type_Colors)
+		assert.NoError(t, err)
+		ids := make([]uint16, 0)
+		for _, pg := range table.Pages {
+			for _, ref := range pg.HeapPositions() {
+				row := &color.Color{}
+				assert.NoError(t, pg.UnmarshalRow(row, ref.HeapPosition))
+				ids = append(ids, row.ID)
+			}
+		}
+		return ids
+	}
+
+	f := dbtest.Create(t, func(db *dbengine.DbEngine) {
+		insert(db, 0, 10)
+	})
+	db := dbtest.Open(t, f)
+	assert.Len(t, rows(db), 10)
+
+	insert(db, 10, 20)
+	table, err := db.GetTable(page.Type_Colors)
+	assert.NoError(t, err)
+	assert.Len(t, table.Pages, 1)
+
+	// Fill up the page, so that more pages must be allocated.
+	insert(db, 20, 300)
+
+	db = dbtest.Open(t, f)
+	ids := rows(db)
+	assert.Len(t, ids, 300)
+	for i := range ids {
+		assert.Equal(t, uint16(i), ids[i])
+	}
+
+	table, err = db.GetTable(page.Type_Colors)
+	assert.NoError(t, err)
+	assert.Greater(t, len(table.Pages), 1)
+	last := table.Pages[len(table.Pages)-1]
+	ptr := db.Globals.Pointers[6]
+	assert.Equal(t, page.Type_Colors, ptr.Type)
+	assert.Equal(t, last.NextPage, ptr.EmptyCandidate)
+	assert.Equal(t, last.PageIndex, ptr.LastPage)
+}
+
+// Deleted rows must disappear from the table, and updated rows must be replaced,
+// also when the replacement does not fit in the original page.
+func TestDbEngine_DeleteRow_UpdateRow(t *testing.T) {
+	db := dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for i := 1; i <= 300; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{
+				Id:   uint32(i),
+				Name: fmt.Sprintf("Genre %d", i),
+			}))
+		}
+	})
+
+	assert.NoError(t, db.DeleteRow(page.Type_Genres, 5))
+	assert.NoError(t, db.DeleteRow(page.Type_Genres, 250))
+	assert.ErrorIs(t, db.DeleteRow(page.Type_Genres, 5), page.ErrRowNotFound)
+	assert.NoError(t, db.UpdateRow(page.Type_Genres, 260, &genre.Genre{Id: 260, Name: "Deep House"}))
+
+	// The first page is full, so this row must be moved to the end of the table.
+	assert.NoError(t, db.UpdateRow(page.Type_Genres, 1, &genre.Genre{Id: 1, Name: "Techno"}))
+	assert.NoError(t, db.Commit())
+
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+
+	names := make(map[uint32]string)
+	pages := make(map[uint32]int)
+	for i := range table.Pages {
+		pg := &table.Pages[i]
+		for _, rowref := range pg.HeapPositions() {
+			if !rowref.Exists {
+				continue
+			}
+			row := &genre.Genre{}
+			assert.NoError(t, pg.UnmarshalRow(row, rowref.HeapPosition))
+			_, duplicate := names[row.Id]
+			assert.False(t, duplicate, "duplicate row %d", row.Id)
+			names[row.Id] = row.Name
+			pages[row.Id] = i
+		}
+	}
+
+	assert.Len(t, names, 298)
+	assert.NotContains(t, names, uint32(5))
+	assert.NotContains(t, names, uint32(250))
+	assert.Equal(t, "Deep House", names[260])
+	assert.Equal(t, "Techno", names[1])
+	assert.Equal(t, "Genre 8", names[8])
+	assert.Equal(t, 1, pages[260])
+	assert.Equal(t, 1, pages[1])
+
+	// Two rows were removed from the first page.
+	first := table.Pages[0]
+	assert.Equal(t, int(first.NumRowsSmall)-2, first.ActiveRows())
+	assert.Equal(t, uint8(first.ActiveRows()*0x20), first.Unknown3)
+}
+
+// Updating rows adds them to the last written rows of their row set, like deleting them does.
+func TestDbEngine_UpdateRow_LastWrittenRows(t *testing.T) {
+	db := dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for i := 1; i <= 5; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{Id: uint32(i), Name: "Genre"}))
+		}
+	})
+
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0b10000), table.Pages[0].RowSets[0].LastWrittenRows)
+
+	assert.NoError(t, db.UpdateRow(page.Type_Genres, 2, &genre.Genre{Id: 2, Name: "House"}))
+	assert.NoError(t, db.UpdateRow(page.Type_Genres, 3, &genre.Genre{Id: 3, Name: "Techno"}))
+
+	table, err = db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	rs := table.Pages[0].RowSets[0]
+	assert.Equal(t, uint16(0b10110), rs.LastWrittenRows)
+	assert.Equal(t, uint16(0b11111), rs.ActiveRows)
+}
+
+// Rows without IDs, such as playlist entries, are deleted by matching their contents.
+func TestDeleteRows(t *testing.T) {
+	db := dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for i := 1; i <= 600; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_PlaylistEntries, &playlist.Entry{
+				EntryIndex: uint32(i),
+				TrackID:    uint32(i),
+				PlaylistID: uint32(i%2 + 1),
+			}))
+		}
+	})
+	// Rows that are not yet committed are deleted too.
+	assert.NoError(t, db.InsertRow(page.Type_PlaylistEntries, &playlist.Entry{EntryIndex: 601, TrackID: 601, PlaylistID: 2}))
+
+	deleted, err := dbengine.DeleteRows(db, page.Type_PlaylistEntries, func(row *playlist.Entry) bool {
+		return row.PlaylistID == 2
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 301, deleted)
+
+	entries, err := dbengine.ReadRows[playlist.Entry](db, page.Type_PlaylistEntries)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 300)
+	for _, entry := range entries {
+		assert.Equal(t, uint32(1), entry.PlaylistID)
+	}
+
+	_, err = dbengine.DeleteRows(db, page.Type_PlaylistEntries, func(row *genre.Genre) bool {
+		return true
+	})
+	assert.Error(t, err)
+}
+
+func TestTable_Rows(t *testing.T) {
+	db := dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for i := 1; i <= 300; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{
+				Id:   uint32(i),
+				Name: fmt.Sprintf("Genre %d", i),
+			}))
+		}
+	})
+	assert.NoError(t, db.DeleteRow(page.Type_Genres, 2))
+
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+
+	ids := make([]uint32, 0)
+	rows := table.Rows()
+	for rows.Next() {
+		row, ok := rows.Row().(*genre.Genre)
+		assert.True(t, ok)
+		assert.Equal(t, fmt.Sprintf("Genre %d", row.Id), row.Name)
+		ids = append(ids, row.Id)
+	}
+
+	assert.NoError(t, rows.Err())
+	assert.Len(t, ids, 299)
+	assert.Equal(t, []uint32{1, 3, 4}, ids[:3])
+	assert.Equal(t, uint32(300), ids[298])
+}
+
+// Playlist entries are small enough that more than 255 rows fit in a page,
+// so the row count must be written to, and read from, NumRowsLarge.
+func TestDbEngine_InsertRow_NumRowsLarge(t *testing.T) {
+	const numEntries = 600
+
+	db := dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for i := 1; i <= numEntries; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_PlaylistEntries, &playlist.Entry{
+				EntryIndex: uint32(i),
+				TrackID:    uint32(i),
+				PlaylistID: 1,
+			}))
+		}
+	})
+	table, err := db.GetTable(page.Type_PlaylistEntries)
+	assert.NoError(t, err)
+
+	first := table.Pages[0]
+	assert.Greater(t, first.NumRows(), 255)
+	assert.Equal(t, uint16(first.NumRows()), first.NumRowsLarge)
+	assert.Equal(t, uint8(first.NumRows()), first.NumRowsSmall)
+	assert.Equal(t, first.NumRows(), first.ActiveRows())
+
+	// The active row count overflows from Unknown3 into Unknown4.
+	active := func() int {
+		return int(first.Unknown3)>>5 | int(first.Unknown4)<<3
+	}
+	assert.Equal(t, first.ActiveRows(), active())
+	assert.NoError(t, first.Delete(first.NumRows()-1))
+	assert.Equal(t, first.NumRows()-1, first.ActiveRows())
+	assert.Equal(t, first.ActiveRows(), active())
+
+	entries, err := dbengine.ReadRows[playlist.Entry](db, page.Type_PlaylistEntries)
+	assert.NoError(t, err)
+	assert.Len(t, entries, numEntries)
+	for i, entry := range entries {
+		assert.Equal(t, uint32(i+1), entry.TrackID)
+	}
+}
+
+// Free space is counted the way rekordbox does: the heap size minus used space and the row index.
+// Pages are checked in a file exported by rekordbox, and after inserting and updating rows.
+func TestDbEngine_FreeSize(t *testing.T) {
+	freeSizeRule := func(db *dbengine.DbEngine) {
+		for _, ty := range db.TableTypes() {
+			table, err := db.GetTable(ty)
+			assert.NoError(t, err)
+			for _, pg := range table.Pages {
+				used := int(pg.FreeSize) + int(pg.NextHeapWriteOffset) + pg.IndexSize()
+				assert.Equal(t, pg.HeapSize(), used, "%s page %d", ty, pg.PageIndex)
+			}
+		}
+	}
+
+	pristine, err := os.Open("../../../testdata/pristine.pdb")
+	assert.NoError(t, err)
+	defer pristine.Close()
+	db, err := dbengine.Open(pristine)
+	assert.NoError(t, err)
+	freeSizeRule(db)
+
+	db = dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for i := 1; i <= 300; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{
+				Id:   uint32(i),
+				Name: fmt.Sprintf("Genre %d", i),
+			}))
+		}
+		assert.NoError(t, db.Commit())
+		assert.NoError(t, db.UpdateRow(page.Type_Genres, 260, &genre.Genre{Id: 260, Name: "Deep House"}))
+	})
+	freeSizeRule(db)
+}
+
+// Tables that fit in a single data page are not indexed, like in exports made by rekordbox.
+func TestDbEngine_InsertPage_SmallTables(t *testing.T) {
+	pristine, err := os.Open("../../../testdata/pristine.pdb")
+	assert.NoError(t, err)
+	defer pristine.Close()
+	expected, err := dbengine.Open(pristine)
+	assert.NoError(t, err)
+
+	db := dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for _, row := range color.InitialDataset {
+			assert.NoError(t, db.InsertRow(page.Type_Colors, row))
+		}
+		for _, row := range column.InitialDataset {
+			assert.NoError(t, db.InsertRow(page.Type_Columns, row))
+		}
+		for _, row := range unknown17.InitialDataset {
+			assert.NoError(t, db.InsertRow(page.Type_Unknown17, row))
+		}
+		for _, row := range unknown18.InitialDataset {
+			assert.NoError(t, db.InsertRow(page.Type_Unknown18, row))
+		}
+	})
+
+	for _, ty := range []page.Type{page.Type_Colors, page.Type_Columns, page.Type_Unknown17, page.Type_Unknown18} {
+		want, err := expected.GetTable(ty)
+		assert.NoError(t, err)
+		table, err := db.GetTable(ty)
+		assert.NoError(t, err)
+
+		assert.Len(t, table.Pages, len(want.Pages), ty.String())
+		for i := range table.Pages {
+			assert.Equal(t, want.Pages[i].PageFlags, table.Pages[i].PageFlags, ty.String())
+		}
+		assert.Equal(t, want.Index.NumEntries, table.Index.NumEntries, ty.String())
+		assert.Equal(t, want.Index.NextOffset, table.Index.NextOffset, ty.String())
+		assert.Equal(t, want.Index.FirstEmptyEntry, table.Index.FirstEmptyEntry, ty.String())
+		assert.Equal(t, want.Index.IndexEntries, table.Index.IndexEntries, ty.String())
+	}
+}
+
+// Every data page of a table is referenced by the table index,
+// also when pages are added after reopening the database.
+func TestDbEngine_InsertPage_Index(t *testing.T) {
+	insert := func(db *dbengine.DbEngine, from, to int) {
+		for i := from; i < to; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{
+				Id:   uint32(i),
+				Name: fmt.Sprintf("Genre number %d", i),
+			}))
+		}
+		assert.NoError(t, db.Commit())
+	}
+
+	f := dbtest.Create(t, func(db *dbengine.DbEngine) {
+		insert(db, 1, 400)
+	})
+	insert(dbtest.Open(t, f), 400, 800)
+
+	db := dbtest.Open(t, f)
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Greater(t, len(table.Pages), 2)
+
+	entries := make([]uint32, 0)
+	for _, pg := range table.Pages {
+		assert.Equal(t, uint8(page.FlagsDataIndexed), pg.PageFlags)
+		entries = append(entries, page.IndexEntry(pg.PageIndex))
+	}
+
+	index := table.Index.IndexHeader
+	assert.Equal(t, entries, index.IndexEntries)
+	assert.Equal(t, uint16(len(entries)), index.NumEntries)
+	assert.Equal(t, uint16(len(entries)*4), index.NextOffset)
+	assert.Equal(t, uint16(0x1fff), index.FirstEmptyEntry)
+	assert.Equal(t, uint16(page.IndexCapacity), index.Unknown3)
+
+	info, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size()%page.TypicalPageSize)
+}
+
+// Indexes that rex did not write are left alone, as the encoding of index entries is not verified.
+func TestDbEngine_InsertPage_Unindexed(t *testing.T) {
+	insert := func(db *dbengine.DbEngine, from, to int) {
+		for i := from; i < to; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{
+				Id:   uint32(i),
+				Name: fmt.Sprintf("Genre number %d", i),
+			}))
+		}
+		assert.NoError(t, db.Commit())
+	}
+
+	f := dbtest.Create(t, func(db *dbengine.DbEngine) {
+		insert(db, 1, 400)
+	})
+	dbtest.Unindex(t, f, page.Type_Genres)
+	before, err := dbtest.Open(t, f).GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Greater(t, len(before.Pages), 1)
+
+	insert(dbtest.Open(t, f), 400, 800)
+
+	db := dbtest.Open(t, f)
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Greater(t, len(table.Pages), len(before.Pages))
+	assert.Empty(t, table.Index.IndexEntries)
+	assert.Empty(t, table.Overflow)
+	for _, pg := range table.Pages {
+		assert.Equal(t, uint8(page.FlagsData), pg.PageFlags)
+	}
+
+	genres, err := dbengine.ReadRows[genre.Genre](db, page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Len(t, genres, 799)
+	assert.Empty(t, verify.Verify(db))
+}
+
+// Tables with more data pages than fit in one index page continue the index on overflow pages.
+func TestDbEngine_InsertPage_IndexOverflow(t *testing.T) {
+	// Only two rows of this size fit in a page.
+	name := func(i int) string {
+		return fmt.Sprintf("%05d %s", i, strings.Repeat("x", 1500))
+	}
+	insert := func(db *dbengine.DbEngine, from, to int) {
+		db.OverflowIndexes = true
+		for i := from; i < to; i++ {
+			assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{
+				Id:   uint32(i),
+				Name: name(i),
+			}))
+		}
+		assert.NoError(t, db.Commit())
+	}
+
+	f := dbtest.Create(t, func(db *dbengine.DbEngine) {
+		insert(db, 1, 2000)
+	})
+	insert(dbtest.Open(t, f), 2000, 2400)
+
+	db := dbtest.Open(t, f)
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Greater(t, len(table.Pages), page.IndexCapacity)
+	assert.Len(t, table.Overflow, 1)
+
+	entries := make([]uint32, 0)
+	for _, pg := range table.Pages {
+		assert.Equal(t, uint8(page.FlagsDataIndexed), pg.PageFlags)
+		entries = append(entries, page.IndexEntry(pg.PageIndex))
+	}
+	assert.Equal(t, entries[:page.IndexCapacity], table.Index.IndexEntries)
+	assert.Equal(t, uint16(0x1fff), table.Index.FirstEmptyEntry)
+	assert.Equal(t, table.Overflow[0].Header.PageIndex, table.Index.NextIndexPage)
+	assert.Equal(t, entries[page.IndexCapacity:], table.Overflow[0].IndexEntries)
+	assert.Equal(t, uint32(page.NoPage), table.Overflow[0].NextIndexPage)
+
+	genres, err := dbengine.ReadRows[genre.Genre](db, page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Len(t, genres, 2399)
+	for i, g := range genres {
+		assert.Equal(t, name(i+1), g.Name)
+	}
+
+	// Other tables are not affected.
+	artists, err := db.GetTable(page.Type_Artists)
+	assert.NoError(t, err)
+	assert.Len(t, artists.Pages, 0)
+	assert.Len(t, artists.Overflow, 0)
+
+	assert.Empty(t, verify.Verify(db))
+}
+
+// Overflow index pages are only written when enabled, as players may not follow them.
+func TestDbEngine_InsertPage_IndexFull(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "export.pdb"))
+	assert.NoError(t, err)
+	defer f.Close()
+	db := dbengine.New(f)
+	assert.NoError(t, db.CreateTable(page.Type_Genres))
+
+	for i := 1; err == nil && i < 2400; i++ {
+		err = db.InsertRow(page.Type_Genres, &genre.Genre{
+			Id:   uint32(i),
+			Name: fmt.Sprintf("%05d %s", i, strings.Repeat("x", 1500)),
+		})
+	}
+	assert.ErrorIs(t, err, dbengine.ErrIndexFull)
+
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Len(t, table.Index.IndexEntries, page.IndexCapacity)
+	assert.Equal(t, uint32(page.NoPage), table.Index.NextIndexPage)
+	assert.Empty(t, table.Overflow)
+}
+
+// Files with a damaged table must still open, so that the other tables can be read.
+func TestOpen_DamagedIndex(t *testing.T) {
+	f := dbtest.Create(t, func(db *dbengine.DbEngine) {
+		assert.NoError(t, db.InsertRow(page.Type_Genres, &genre.Genre{Id: 1, Name: "House"}))
+	})
+	dbtest.DamageIndex(t, f, page.Type_Tracks)
+	db := dbtest.Open(t, f)
+
+	table, err := db.GetTable(page.Type_Genres)
+	assert.NoError(t, err)
+	assert.Len(t, table.Pages, 1)
+	assert.Equal(t, 1, table.Pages[0].ActiveRows())
+
+	_, err = db.GetTable(page.Type_Tracks)
+	assert.Error(t, err)
+	assert.NoError(t, db.InsertRow(page.Type_Tracks, &track.Track{Title: "Track"}))
+	assert.Error(t, db.Commit())
+}
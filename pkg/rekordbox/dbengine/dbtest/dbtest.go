@@ -0,0 +1,93 @@
+package dbtest
+
+// Database files for tests.
+
+import (
+	`os`
+	`path/filepath`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/pdb`
+	`github.com/stretchr/testify/assert`
+)
+
+// Byte offset of the page flags in a page header.
+const pageFlagsOffset = 27
+
+// Create a database file with all the tables of an export, fill it with rows, and commit it.
+// The file is opened for reading and writing, and closed when the test ends.
+func Create(t *testing.T, fill func(db *dbengine.DbEngine)) *os.File {
+	f, err := os.Create(filepath.Join(t.TempDir(), "export.pdb"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	db := dbengine.New(f)
+	for _, pageType := range pdb.TableOrder {
+		assert.NoError(t, db.CreateTable(pageType))
+	}
+	fill(db)
+	assert.NoError(t, db.Commit())
+
+	return f
+}
+
+// Create a database file, and open it again, so that it is read back the way it was written.
+func Export(t *testing.T, fill func(db *dbengine.DbEngine)) *dbengine.DbEngine {
+	return Open(t, Create(t, fill))
+}
+
+// Open a database file, failing the test if it cannot be opened.
+func Open(t *testing.T, f *os.File) *dbengine.DbEngine {
+	db, err := dbengine.Open(f)
+	assert.NoError(t, err)
+	return db
+}
+
+// Copy a database file into a temporary directory, so that tests can modify it.
+// The copy is opened for reading and writing, and closed when the test ends.
+func Copy(t *testing.T, path string) *os.File {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	dest := filepath.Join(t.TempDir(), filepath.Base(path))
+	assert.NoError(t, os.WriteFile(dest, data, 0644))
+
+	f, err := os.OpenFile(dest, os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// Overwrite the flags of the index page of a table, e.g. to test how a damaged file is handled.
+func DamageIndex(t *testing.T, f *os.File, pageType page.Type) {
+	db := Open(t, f)
+	for _, ptr := range db.Globals.Pointers {
+		if ptr.Type != pageType {
+			continue
+		}
+		_, err := f.WriteAt([]byte{page.FlagsData}, int64(ptr.FirstPage)*page.TypicalPageSize+pageFlagsOffset)
+		assert.NoError(t, err)
+		return
+	}
+	t.Fatalf("table %s does not exist", pageType)
+}
+
+// Empty the index of a table and flag its data pages as not indexed,
+// the way rekordbox leaves some tables with several data pages.
+func Unindex(t *testing.T, f *os.File, pageType page.Type) {
+	table, err := Open(t, f).GetTable(pageType)
+	assert.NoError(t, err)
+
+	index := table.Index
+	index.IndexEntries = nil
+	data, err := index.MarshalBinary()
+	assert.NoError(t, err)
+	_, err = f.WriteAt(data, int64(index.Header.PageIndex)*page.TypicalPageSize)
+	assert.NoError(t, err)
+
+	for _, pg := range table.Pages {
+		_, err = f.WriteAt([]byte{page.FlagsData}, int64(pg.PageIndex)*page.TypicalPageSize+pageFlagsOffset)
+		assert.NoError(t, err)
+	}
+}
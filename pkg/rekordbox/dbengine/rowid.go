@@ -0,0 +1,35 @@
+package dbengine
+
+import (
+	`encoding/binary`
+	`io`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+)
+
+// Position of the 32-bit row ID in tables where rows can be looked up by ID.
+var rowIDOffsets = map[page.Type]int{
+	page.Type_Tracks:           0x48,
+	page.Type_Genres:           0x00,
+	page.Type_Artists:          0x04,
+	page.Type_Albums:           0x0c,
+	page.Type_Labels:           0x00,
+	page.Type_Keys:             0x00,
+	page.Type_PlaylistTree:     0x0c,
+	page.Type_HistoryPlaylists: 0x00,
+	page.Type_Artwork:          0x00,
+}
+
+// Reads only the ID of a row.
+type rowID struct {
+	offset int
+	id     uint32
+}
+
+func (r *rowID) UnmarshalBinary(data []byte) error {
+	if len(data) < r.offset+4 {
+		return io.ErrShortBuffer
+	}
+	r.id = binary.LittleEndian.Uint32(data[r.offset:])
+	return nil
+}
@@ -1,44 +1,47 @@
 package dbengine
 
 import (
+	`encoding`
 	`fmt`
 	`io`
 
 	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox`
 	`github.com/ambientsound/rex/pkg/rekordbox/page`
 )
 
 type Table struct {
-	Type  page.Type
-	Index page.Index
-	Pages []page.Data
+	Type     page.Type
+	Index    page.Index
+	Overflow []page.Index // Index pages linked from the first one, for tables with many pages.
+	Pages    []page.Data
 }
 
 func (db *DbEngine) GetTable(pageType page.Type) (*Table, error) {
-	pageNum, err := db.tableIndex(pageType)
+	ptr, err := db.tablePointer(pageType)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.seekToPage(pageNum)
-	if err != nil {
-		return nil, err
-	}
-
-	idx, err := db.readIndex()
+	indices, err := db.readIndexChain(ptr.FirstPage)
 	if err != nil {
 		return nil, err
 	}
+	idx := indices[0]
 
 	table := &Table{
-		Type:  pageType,
-		Pages: make([]page.Data, 0),
-		Index: *idx,
+		Type:     pageType,
+		Pages:    make([]page.Data, 0),
+		Index:    *idx,
+		Overflow: make([]page.Index, 0, len(indices)-1),
+	}
+	for _, overflow := range indices[1:] {
+		table.Overflow = append(table.Overflow, *overflow)
 	}
 
 	nextPage := idx.IndexHeader.NextPage
 
-	for {
+	for ptr.LastPage != ptr.FirstPage {
 		var data *page.Data
 		err = db.seekToPage(nextPage)
 		if err != nil {
@@ -51,12 +54,104 @@ func (db *DbEngine) GetTable(pageType page.Type) (*Table, error) {
 			return nil, err
 		}
 		table.Pages = append(table.Pages, *data)
+		if data.PageIndex == ptr.LastPage {
+			break
+		}
 		nextPage = data.NextPage
 	}
 
 	return table, nil
 }
 
+// Iterates over the rows present in a table, decoding them into structs.
+// Deleted rows are skipped.
+//
+//	rows := table.Rows()
+//	for rows.Next() {
+//		row := rows.Row()
+//	}
+//	err := rows.Err()
+type RowIterator struct {
+	table     *Table
+	pageIndex int
+	refs      []page.RowReference
+	row       encoding.BinaryUnmarshaler
+	err       error
+}
+
+func (table *Table) Rows() *RowIterator {
+	return &RowIterator{
+		table:     table,
+		pageIndex: -1,
+	}
+}
+
+// Decode the next row. Returns false when there are no more rows, or an error occurred.
+func (it *RowIterator) Next() bool {
+	it.row = nil
+	if it.err != nil {
+		return false
+	}
+
+	for {
+		for len(it.refs) == 0 {
+			it.pageIndex++
+			if it.pageIndex >= len(it.table.Pages) {
+				return false
+			}
+			it.refs = it.table.Pages[it.pageIndex].HeapPositions()
+		}
+
+		rowref := it.refs[0]
+		it.refs = it.refs[1:]
+		if !rowref.Exists {
+			continue
+		}
+
+		row := rekordbox.NewRow(it.table.Type)
+		if row == nil {
+			it.err = fmt.Errorf("rows of table '%s' can not be decoded", it.table.Type)
+			return false
+		}
+
+		it.err = it.table.Pages[it.pageIndex].UnmarshalRow(row, rowref.HeapPosition)
+		if it.err != nil {
+			return false
+		}
+
+		it.row = row
+		return true
+	}
+}
+
+// The row decoded by the last call to Next.
+func (it *RowIterator) Row() encoding.BinaryUnmarshaler {
+	return it.row
+}
+
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+// Read all rows present in a table.
+// T is the row type registered for the table.
+func ReadRows[T any](db *DbEngine, pageType page.Type) ([]*T, error) {
+	table, err := db.GetTable(pageType)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*T, 0)
+	rows := table.Rows()
+	for rows.Next() {
+		row, ok := any(rows.Row()).(*T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected row type %T in table '%s'", rows.Row(), pageType)
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
 func (db *DbEngine) TableTypes() []page.Type {
 	types := make([]page.Type, db.Globals.NumTables)
 	var i uint32
@@ -66,15 +161,6 @@ func (db *DbEngine) TableTypes() []page.Type {
 	return types
 }
 
-func (db *DbEngine) tableIndex(pageType page.Type) (uint32, error) {
-	for _, ptr := range db.Globals.Pointers {
-		if ptr.Type == pageType {
-			return ptr.FirstPage, nil
-		}
-	}
-	return 0, fmt.Errorf("table '%s' not found", pageType)
-}
-
 func (db *DbEngine) readIndex() (*page.Index, error) {
 	index := &page.Index{}
 	err := marshal.UnpackFrom(db.backend, index)
@@ -82,13 +168,48 @@ func (db *DbEngine) readIndex() (*page.Index, error) {
 		return nil, err
 	}
 
-	if index.PageFlags != 0x64 {
+	if index.PageFlags != page.FlagsIndex {
 		return nil, fmt.Errorf("index page flags not 0x64")
 	}
 
 	return index, nil
 }
 
+// Read a single page, without decoding it or following links to other pages.
+func (db *DbEngine) ReadPage(pageIndex uint32) ([]byte, error) {
+	err := db.seekToPage(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, db.Globals.LenPage)
+	_, err = io.ReadFull(db.backend, data)
+	return data, err
+}
+
+// Read the index page of a table, and the index pages linked from it.
+func (db *DbEngine) readIndexChain(pageIndex uint32) ([]*page.Index, error) {
+	indices := make([]*page.Index, 0, 1)
+	for {
+		err := db.seekToPage(pageIndex)
+		if err != nil {
+			return nil, err
+		}
+		index, err := db.readIndex()
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, index)
+
+		pageIndex = index.IndexHeader.NextIndexPage
+		if pageIndex == page.NoPage || pageIndex == 0 {
+			return indices, nil
+		}
+		if len(indices) > int(db.Globals.NextUnusedPage) {
+			return nil, fmt.Errorf("index pages form a loop")
+		}
+	}
+}
+
 func (db *DbEngine) readData() (*page.Data, error) {
 	data := make([]byte, 4096)
 	_, err := io.ReadFull(db.backend, data)
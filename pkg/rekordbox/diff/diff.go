@@ -0,0 +1,292 @@
+package diff
+
+// Compare two PDB files field by field, e.g. an export made by rekordbox against one made by rex.
+
+import (
+	`encoding`
+	`fmt`
+	`reflect`
+
+	`github.com/ambientsound/rex/pkg/rekordbox`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/pdb`
+)
+
+// Printed in place of a value that is present in only one of the files.
+const Missing = "<missing>"
+
+// A value that is not the same in both files.
+type Difference struct {
+	Where string // File header, table, page or row.
+	Field string // Empty if the whole page or row is missing from one of the files.
+	A     string
+	B     string
+}
+
+func (d Difference) String() string {
+	if d.Field == "" {
+		return fmt.Sprintf("%s: %s != %s", d.Where, d.A, d.B)
+	}
+	return fmt.Sprintf("%s: %s: %s != %s", d.Where, d.Field, d.A, d.B)
+}
+
+// A decoded row, and the key that lines it up with the same row in the other file.
+type row struct {
+	key  string
+	data encoding.BinaryUnmarshaler
+}
+
+type differ struct {
+	a, b        *dbengine.DbEngine
+	differences []Difference
+}
+
+// Compare the file headers, table pointers, index and data page headers, and rows of two files.
+// Tables are lined up by type, pages by their position in the table, and rows by ID.
+// Rows without an ID are lined up by their position in the table.
+// Returns the differences found, or an empty list if the files have the same contents.
+func Compare(a, b *dbengine.DbEngine) ([]Difference, error) {
+	d := &differ{
+		a:           a,
+		b:           b,
+		differences: make([]Difference, 0),
+	}
+
+	// Table pointers are compared by table type below, as the tables may be listed in another order.
+	globalsA, globalsB := *a.Globals, *b.Globals
+	globalsA.Pointers, globalsB.Pointers = nil, nil
+	d.fields("file header", "", reflect.ValueOf(globalsA), reflect.ValueOf(globalsB))
+
+	types := a.TableTypes()
+	pointersA := tablePointers(a)
+	pointersB := tablePointers(b)
+	for _, ty := range b.TableTypes() {
+		if _, found := pointersA[ty]; !found {
+			types = append(types, ty)
+		}
+	}
+
+	for _, ty := range types {
+		ptrA, foundA := pointersA[ty]
+		ptrB, foundB := pointersB[ty]
+		where := ty.String()[5:]
+		if !foundA || !foundB {
+			d.missing(where, foundA, foundB)
+			continue
+		}
+		d.fields(where+" table pointer", "", reflect.ValueOf(ptrA), reflect.ValueOf(ptrB))
+		err := d.table(ty)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d.differences, nil
+}
+
+func tablePointers(db *dbengine.DbEngine) map[page.Type]pdb.TablePointer {
+	pointers := make(map[page.Type]pdb.TablePointer)
+	for _, ptr := range db.Globals.Pointers {
+		pointers[ptr.Type] = ptr
+	}
+	return pointers
+}
+
+// Compare the pages and rows of a table present in both files.
+func (d *differ) table(ty page.Type) error {
+	name := ty.String()[5:]
+
+	// Damaged tables are reported, so that the rest of the files can still be compared.
+	tableA, errA := d.a.GetTable(ty)
+	tableB, errB := d.b.GetTable(ty)
+	if errA != nil || errB != nil {
+		d.differences = append(d.differences, Difference{
+			Where: name + " table",
+			A:     readable(errA),
+			B:     readable(errB),
+		})
+		return nil
+	}
+
+	indexA := append([]page.Index{tableA.Index}, tableA.Overflow...)
+	indexB := append([]page.Index{tableB.Index}, tableB.Overflow...)
+	for i := 0; i < len(indexA) || i < len(indexB); i++ {
+		where := fmt.Sprintf("%s index page #%d", name, i)
+		if i >= len(indexA) || i >= len(indexB) {
+			d.missing(where, i < len(indexA), i < len(indexB))
+			continue
+		}
+		d.fields(where, "", reflect.ValueOf(indexA[i].Header), reflect.ValueOf(indexB[i].Header))
+		d.fields(where, "", reflect.ValueOf(indexA[i].IndexHeader), reflect.ValueOf(indexB[i].IndexHeader))
+	}
+
+	for i := 0; i < len(tableA.Pages) || i < len(tableB.Pages); i++ {
+		where := fmt.Sprintf("%s data page #%d", name, i)
+		if i >= len(tableA.Pages) || i >= len(tableB.Pages) {
+			d.missing(where, i < len(tableA.Pages), i < len(tableB.Pages))
+			continue
+		}
+		pageA, pageB := &tableA.Pages[i], &tableB.Pages[i]
+		d.fields(where, "", reflect.ValueOf(pageA.Header), reflect.ValueOf(pageB.Header))
+		d.fields(where, "", reflect.ValueOf(pageA.DataHeader), reflect.ValueOf(pageB.DataHeader))
+		d.fields(where, "NumRows()", reflect.ValueOf(pageA.NumRows()), reflect.ValueOf(pageB.NumRows()))
+		d.fields(where, "ActiveRows()", reflect.ValueOf(pageA.ActiveRows()), reflect.ValueOf(pageB.ActiveRows()))
+		d.fields(where, "RowSets", reflect.ValueOf(pageA.RowSets), reflect.ValueOf(pageB.RowSets))
+	}
+
+	rowsA, err := readRows(tableA)
+	if err != nil {
+		return fmt.Errorf("read rows of table %s in first file: %w", name, err)
+	}
+	rowsB, err := readRows(tableB)
+	if err != nil {
+		return fmt.Errorf("read rows of table %s in second file: %w", name, err)
+	}
+
+	byKey := make(map[string]encoding.BinaryUnmarshaler)
+	for _, r := range rowsB {
+		byKey[r.key] = r.data
+	}
+	seen := make(map[string]bool)
+	for _, r := range rowsA {
+		where := fmt.Sprintf("%s row %s", name, r.key)
+		seen[r.key] = true
+		other, found := byKey[r.key]
+		if !found {
+			d.missing(where, true, false)
+			continue
+		}
+		d.fields(where, "", reflect.ValueOf(r.data).Elem(), reflect.ValueOf(other).Elem())
+	}
+	for _, r := range rowsB {
+		if !seen[r.key] {
+			d.missing(fmt.Sprintf("%s row %s", name, r.key), false, true)
+		}
+	}
+
+	return nil
+}
+
+// Decode the rows present in a table.
+// Tables without a decoder are skipped.
+func readRows(table *dbengine.Table) ([]row, error) {
+	rows := make([]row, 0)
+	if rekordbox.NewRow(table.Type) == nil {
+		return rows, nil
+	}
+	it := table.Rows()
+	for it.Next() {
+		rows = append(rows, row{
+			key:  rowKey(it.Row(), len(rows)),
+			data: it.Row(),
+		})
+	}
+	return rows, it.Err()
+}
+
+// The ID of a row, or its position in the table if it has no ID field.
+func rowKey(data encoding.BinaryUnmarshaler, position int) string {
+	v := reflect.ValueOf(data).Elem()
+	for _, name := range []string{"Id", "ID"} {
+		field := v.FieldByName(name)
+		if field.IsValid() && field.CanUint() {
+			return fmt.Sprintf("id=%d", field.Uint())
+		}
+	}
+	return fmt.Sprintf("#%d", position)
+}
+
+// Printed in place of a table that could not be read.
+func readable(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "readable"
+}
+
+// Record that a page or row is present in only one of the files.
+func (d *differ) missing(where string, inA, inB bool) {
+	a, b := Missing, Missing
+	if inA {
+		a = "present"
+	}
+	if inB {
+		b = "present"
+	}
+	d.differences = append(d.differences, Difference{
+		Where: where,
+		A:     a,
+		B:     b,
+	})
+}
+
+// Compare two values of the same type, descending into struct fields.
+// Field names of embedded structs are prefixed with the struct name.
+func (d *differ) fields(where string, name string, a, b reflect.Value) {
+	switch a.Kind() {
+	case reflect.Slice:
+		d.slices(where, name, a, b)
+		return
+	case reflect.Pointer, reflect.Interface:
+		if !a.IsNil() && !b.IsNil() {
+			d.fields(where, name, a.Elem(), b.Elem())
+			return
+		}
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldName := field.Name
+			if name != "" {
+				fieldName = name + "." + field.Name
+			}
+			d.fields(where, fieldName, a.Field(i), b.Field(i))
+		}
+		return
+	}
+
+	if a.Interface() == b.Interface() {
+		return
+	}
+	d.differences = append(d.differences, Difference{
+		Where: where,
+		Field: name,
+		A:     format(a),
+		B:     format(b),
+	})
+}
+
+// Compare slices element by element.
+// Only the first differing element is reported, as an inserted or removed element shifts all the following ones.
+func (d *differ) slices(where string, name string, a, b reflect.Value) {
+	if a.Len() != b.Len() {
+		d.differences = append(d.differences, Difference{
+			Where: where,
+			Field: name + " length",
+			A:     fmt.Sprintf("%d", a.Len()),
+			B:     fmt.Sprintf("%d", b.Len()),
+		})
+	}
+	for i := 0; i < a.Len() && i < b.Len(); i++ {
+		found := len(d.differences)
+		d.fields(where, fmt.Sprintf("%s[%d]", name, i), a.Index(i), b.Index(i))
+		if len(d.differences) > found {
+			return
+		}
+	}
+}
+
+// Unsigned numbers are printed in hex as well, since unknown fields are often flags or packed values.
+func format(v reflect.Value) string {
+	switch {
+	case v.Kind() == reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case v.CanUint():
+		return fmt.Sprintf("%d (0x%x)", v.Uint(), v.Uint())
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
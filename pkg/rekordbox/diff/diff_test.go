@@ -0,0 +1,158 @@
+package diff_test
+
+import (
+	`fmt`
+	`os`
+	`strings`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/artist`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine/dbtest`
+	`github.com/ambientsound/rex/pkg/rekordbox/diff`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+	`github.com/stretchr/testify/assert`
+)
+
+// Write a small export with the given artists and tracks.
+func export(t *testing.T, artists []*artist.Artist, tracks []*track.Track) *dbengine.DbEngine {
+	return dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for _, row := range artists {
+			assert.NoError(t, db.InsertRow(page.Type_Artists, row))
+		}
+		for _, row := range tracks {
+			assert.NoError(t, db.InsertRow(page.Type_Tracks, row))
+		}
+	})
+}
+
+func newTrack(id uint32, title string) *track.Track {
+	tr := &track.Track{
+		Title:    title,
+		FilePath: "/rex/" + title + ".mp3",
+	}
+	tr.Id = id
+	tr.ArtistId = 1
+	return tr
+}
+
+func TestCompare(t *testing.T) {
+	a := export(t,
+		[]*artist.Artist{{Id: 1, Name: "Artist"}, {Id: 2, Name: "Other"}},
+		[]*track.Track{newTrack(1, "One"), newTrack(2, "Two")},
+	)
+	changed := newTrack(2, "Two")
+	changed.Comment = "Peak time"
+	b := export(t,
+		[]*artist.Artist{{Id: 1, Name: "Artist"}},
+		[]*track.Track{newTrack(1, "One"), changed},
+	)
+
+	differences, err := diff.Compare(a, b)
+	assert.NoError(t, err)
+
+	assert.Contains(t, differences, diff.Difference{
+		Where: "Artists row id=2",
+		A:     "present",
+		B:     diff.Missing,
+	})
+	assert.Contains(t, differences, diff.Difference{
+		Where: "Tracks row id=2",
+		Field: "Comment",
+		A:     `""`,
+		B:     `"Peak time"`,
+	})
+	// Adding a comment moves the title string. Its exact position depends on the row layout.
+	offsets := 0
+	for _, difference := range differences {
+		if difference.Where == "Tracks row id=2" && difference.Field == "StringOffsets.Title" {
+			offsets++
+			assert.NotEqual(t, difference.A, difference.B)
+		}
+	}
+	assert.Equal(t, 1, offsets)
+	assert.Contains(t, differences, diff.Difference{
+		Where: "Artists data page #0",
+		Field: "NumRowsSmall",
+		A:     "2 (0x2)",
+		B:     "1 (0x1)",
+	})
+	assert.Contains(t, differences, diff.Difference{
+		Where: "Artists data page #0",
+		Field: "RowSets[0].ActiveRows",
+		A:     "3 (0x3)",
+		B:     "1 (0x1)",
+	})
+	for _, difference := range differences {
+		assert.NotEqual(t, "Tracks row id=1", difference.Where)
+	}
+}
+
+// Slices are compared element by element, and only the first differing element is reported.
+func TestCompare_Slices(t *testing.T) {
+	artists := make([]*artist.Artist, 0)
+	for i := 1; i <= 300; i++ {
+		artists = append(artists, &artist.Artist{Id: uint32(i), Name: fmt.Sprintf("Artist number %d", i)})
+	}
+	a := export(t, artists, nil)
+	b := export(t, artists[:1], nil)
+
+	table, err := a.GetTable(page.Type_Artists)
+	assert.NoError(t, err)
+	assert.Greater(t, len(table.Pages), 1)
+
+	differences, err := diff.Compare(a, b)
+	assert.NoError(t, err)
+
+	assert.Contains(t, differences, diff.Difference{
+		Where: "Artists index page #0",
+		Field: "IndexEntries length",
+		A:     fmt.Sprintf("%d", len(table.Pages)),
+		B:     "0",
+	})
+	positions := 0
+	for _, difference := range differences {
+		if difference.Where == "Artists data page #0" && strings.HasPrefix(difference.Field, "RowSets[0].Positions") {
+			positions++
+			assert.Equal(t, "RowSets[0].Positions[1]", difference.Field)
+		}
+	}
+	assert.Equal(t, 1, positions)
+}
+
+func TestDifference_String(t *testing.T) {
+	d := diff.Difference{Where: "Tracks row id=2", Field: "Header.Unnamed7", A: "30090 (0x758a)", B: "21101 (0x526d)"}
+	assert.Equal(t, "Tracks row id=2: Header.Unnamed7: 30090 (0x758a) != 21101 (0x526d)", d.String())
+	d = diff.Difference{Where: "History data page #0", A: "present", B: diff.Missing}
+	assert.Equal(t, "History data page #0: present != <missing>", d.String())
+}
+
+func TestCompare_Pristine(t *testing.T) {
+	f, err := os.Open("../../../testdata/pristine.pdb")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	db, err := dbengine.Open(f)
+	assert.NoError(t, err)
+	differences, err := diff.Compare(db, db)
+	assert.NoError(t, err)
+	assert.Empty(t, differences)
+}
+
+func TestCompare_DamagedTable(t *testing.T) {
+	pristine, err := os.Open("../../../testdata/pristine.pdb")
+	assert.NoError(t, err)
+	defer pristine.Close()
+	a, err := dbengine.Open(pristine)
+	assert.NoError(t, err)
+
+	f := dbtest.Copy(t, "../../../testdata/pristine.pdb")
+	dbtest.DamageIndex(t, f, page.Type_Artists)
+
+	differences, err := diff.Compare(a, dbtest.Open(t, f))
+	assert.NoError(t, err)
+	assert.Len(t, differences, 1)
+	assert.Equal(t, "Artists table", differences[0].Where)
+	assert.Equal(t, "readable", differences[0].A)
+}
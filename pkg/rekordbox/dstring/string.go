@@ -197,6 +197,20 @@ func (s IsrcString) MarshalBinary() ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+// Decode a string written as an IsrcString.
+// Strings in other formats are decoded as usual.
+func UnmarshalIsrc(data []byte) (string, error) {
+	const headerSize = 4
+	if len(data) < headerSize || StringEncoding(data[0]) != StringEncodingLongUTF16LE {
+		return UnmarshalBinary(data)
+	}
+	length := int(binary.LittleEndian.Uint16(data[1:]))
+	if length < headerSize+2 || length > len(data) || data[headerSize] != 0x03 {
+		return UnmarshalBinary(data)
+	}
+	return string(data[headerSize+1 : length-1]), nil
+}
+
 func isASCII(s string) bool {
 	for _, c := range s {
 		if c > unicode.MaxASCII {
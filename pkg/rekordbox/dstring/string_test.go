@@ -69,3 +69,17 @@ func TestIsrcString_MarshalBinary(t *testing.T) {
 		0x30, 0x39, 0x30, 0x30, 0x33, 0x00,
 	}, data)
 }
+
+func TestUnmarshalIsrc(t *testing.T) {
+	isrc, err := dstring.UnmarshalIsrc([]byte{
+		0x90, 0x12, 0x00, 0x00, 0x03, 0x47, 0x42, 0x4a, 0x58, 0x33, 0x38, 0x32,
+		0x30, 0x39, 0x30, 0x30, 0x33, 0x00,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "GBJX38209003", isrc)
+
+	// Empty strings are written in the short format.
+	isrc, err = dstring.UnmarshalIsrc([]byte{0x03})
+	assert.NoError(t, err)
+	assert.Equal(t, "", isrc)
+}
@@ -0,0 +1,39 @@
+package genre
+
+import (
+	`bytes`
+
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox/dstring`
+)
+
+/**
+ * A row that holds a genre name and the associated ID.
+ */
+type Genre struct {
+	Id   uint32
+	Name string
+}
+
+func (genre *Genre) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := marshal.PackInto(buf, &genre.Id)
+	if err != nil {
+		return nil, err
+	}
+	nameEncoder := dstring.New(genre.Name)
+	err = marshal.Into(buf, nameEncoder)
+	return buf.Bytes(), err
+}
+
+func (genre *Genre) UnmarshalBinary(data []byte) error {
+	err := marshal.Unpack(&genre.Id, data)
+	if err != nil {
+		return err
+	}
+	genre.Name, err = dstring.UnmarshalBinary(data[4:])
+	return err
+}
+
+func (genre *Genre) SetIndexShift(shift uint16) {
+}
@@ -0,0 +1,35 @@
+package genre_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/genre`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestGenre_MarshalBinary(t *testing.T) {
+	expected := []byte{
+		0x07, 0x00, 0x00, 0x00, 0x0f, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x6f,
+	}
+
+	g := genre.Genre{
+		Id:   7,
+		Name: "Techno",
+	}
+
+	data, err := g.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+}
+
+func TestGenre_UnmarshalBinary(t *testing.T) {
+	g := &genre.Genre{}
+	err := g.UnmarshalBinary([]byte{
+		0x07, 0x00, 0x00, 0x00, 0x0f, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x6f,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(7), g.Id)
+	assert.Equal(t, "Techno", g.Name)
+}
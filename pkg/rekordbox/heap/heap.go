@@ -140,7 +140,7 @@ func (heap *Heap) CursorBottom() int {
 
 // Pad the data on the top buffer with zeroes until its length is a multiple of `align`
 func (heap *Heap) AlignTop(align int) error {
-	remainder := align - (heap.top.Len() % align)
+	remainder := (align - heap.top.Len()%align) % align
 	padding := make([]byte, remainder)
 	_, err := heap.top.Write(padding)
 	return err
@@ -0,0 +1,60 @@
+package history
+
+import (
+	`bytes`
+
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox/dstring`
+)
+
+/**
+ * A row that holds a history playlist ID and name, linking to
+ * the track IDs captured during a performance on the player.
+ */
+type Playlist struct {
+	Id   uint32
+	Name string
+}
+
+func (playlist *Playlist) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := marshal.PackInto(buf, &playlist.Id)
+	if err != nil {
+		return nil, err
+	}
+	nameEncoder := dstring.New(playlist.Name)
+	err = marshal.Into(buf, nameEncoder)
+	return buf.Bytes(), err
+}
+
+func (playlist *Playlist) UnmarshalBinary(data []byte) error {
+	err := marshal.Unpack(&playlist.Id, data)
+	if err != nil {
+		return err
+	}
+	playlist.Name, err = dstring.UnmarshalBinary(data[4:])
+	return err
+}
+
+func (playlist *Playlist) SetIndexShift(shift uint16) {
+}
+
+/**
+ * A row that associates a track with a position in a history playlist.
+ */
+type Entry struct {
+	TrackID    uint32
+	PlaylistID uint32
+	EntryIndex uint32
+}
+
+func (entry *Entry) MarshalBinary() ([]byte, error) {
+	return marshal.Pack(entry)
+}
+
+func (entry *Entry) UnmarshalBinary(data []byte) error {
+	return marshal.Unpack(entry, data)
+}
+
+func (entry *Entry) SetIndexShift(shift uint16) {
+}
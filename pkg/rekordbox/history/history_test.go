@@ -0,0 +1,30 @@
+package history_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/history`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestPlaylist_UnmarshalBinary(t *testing.T) {
+	p := &history.Playlist{}
+	err := p.UnmarshalBinary([]byte{
+		0x01, 0x00, 0x00, 0x00, 0x19, 0x48, 0x49, 0x53, 0x54, 0x4f, 0x52, 0x59,
+		0x20, 0x30, 0x30, 0x31,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), p.Id)
+	assert.Equal(t, "HISTORY 001", p.Name)
+}
+
+func TestEntry_UnmarshalBinary(t *testing.T) {
+	e := &history.Entry{}
+	err := e.UnmarshalBinary([]byte{
+		0x2a, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, history.Entry{TrackID: 42, PlaylistID: 1, EntryIndex: 3}, *e)
+}
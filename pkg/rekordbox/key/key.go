@@ -0,0 +1,45 @@
+package key
+
+import (
+	`bytes`
+
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox/dstring`
+)
+
+type Header struct {
+	Id  uint32
+	Id2 uint32 // Seems to be a second copy of the ID.
+}
+
+/**
+ * A row that holds a musical key and the associated ID.
+ */
+type Key struct {
+	Header
+	Name string
+}
+
+func (key *Key) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	key.Id2 = key.Id
+	err := marshal.PackInto(buf, &key.Header)
+	if err != nil {
+		return nil, err
+	}
+	nameEncoder := dstring.New(key.Name)
+	err = marshal.Into(buf, nameEncoder)
+	return buf.Bytes(), err
+}
+
+func (key *Key) UnmarshalBinary(data []byte) error {
+	err := marshal.Unpack(&key.Header, data)
+	if err != nil {
+		return err
+	}
+	key.Name, err = dstring.UnmarshalBinary(data[8:])
+	return err
+}
+
+func (key *Key) SetIndexShift(shift uint16) {
+}
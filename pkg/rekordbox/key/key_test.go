@@ -0,0 +1,38 @@
+package key_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/key`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestKey_MarshalBinary(t *testing.T) {
+	expected := []byte{
+		0x03, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x07, 0x41, 0x6d,
+	}
+
+	k := key.Key{
+		Header: key.Header{
+			Id: 3,
+		},
+		Name: "Am",
+	}
+
+	data, err := k.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+}
+
+func TestKey_UnmarshalBinary(t *testing.T) {
+	k := &key.Key{}
+	err := k.UnmarshalBinary([]byte{
+		0x03, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x07, 0x38, 0x41,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), k.Id)
+	assert.Equal(t, uint32(3), k.Id2)
+	assert.Equal(t, "8A", k.Name)
+}
@@ -0,0 +1,39 @@
+package label
+
+import (
+	`bytes`
+
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox/dstring`
+)
+
+/**
+ * A row that holds a label name and the associated ID.
+ */
+type Label struct {
+	Id   uint32
+	Name string
+}
+
+func (label *Label) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := marshal.PackInto(buf, &label.Id)
+	if err != nil {
+		return nil, err
+	}
+	nameEncoder := dstring.New(label.Name)
+	err = marshal.Into(buf, nameEncoder)
+	return buf.Bytes(), err
+}
+
+func (label *Label) UnmarshalBinary(data []byte) error {
+	err := marshal.Unpack(&label.Id, data)
+	if err != nil {
+		return err
+	}
+	label.Name, err = dstring.UnmarshalBinary(data[4:])
+	return err
+}
+
+func (label *Label) SetIndexShift(shift uint16) {
+}
@@ -0,0 +1,34 @@
+package label_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/label`
+	`github.com/stretchr/testify/assert`
+)
+
+var labelRow = []byte{
+	0x03, 0x00, 0x00, 0x00, 0x1b,
+	0x57, 0x61, 0x72, 0x70, 0x20, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73,
+}
+
+func TestLabel_MarshalBinary(t *testing.T) {
+	l := label.Label{
+		Id:   3,
+		Name: "Warp Records",
+	}
+
+	data, err := l.MarshalBinary()
+
+	assert.NoError(t, err)
+	assert.Equal(t, labelRow, data)
+}
+
+func TestLabel_UnmarshalBinary(t *testing.T) {
+	l := &label.Label{}
+	err := l.UnmarshalBinary(labelRow)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), l.Id)
+	assert.Equal(t, "Warp Records", l.Name)
+}
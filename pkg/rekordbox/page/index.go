@@ -16,9 +16,23 @@ type Index struct {
 	IndexHeader
 }
 
+// Number of entries that fit in an index page.
+const IndexCapacity = (TypicalPageSize - IndexHeaderSize - indexFooterSize) / 4
+
+// Index pages end with bytes that are always zero.
+const indexFooterSize = 20
+
+// Value of unused index entries: an empty page reference without flags.
+const EmptyIndexEntry = 0x1ffffff8
+
+// Page index meaning "no page".
+const NoPage = 0x03ffffff
+
+// Value of FirstEmptyEntry when there are no free entries among the used ones.
+const noIndexEntry = 0x1fff
+
 // The first page entry for any table is an index table.
-// It is not clear how to use this functionality.
-// Instead, we use commonly found values that are assumed to work.
+// Its entries reference the data pages of the table that are flagged with 0x34.
 // 28 bytes?
 type IndexHeader struct {
 	// unknown1-2 changes from (ff1f ff1f ec03 0000)
@@ -27,24 +41,26 @@ type IndexHeader struct {
 	// upon deleting, renaming entries in this table.
 	Unknown1   uint16 // Usually 0x1fff, sometimes 0x0001 (keys, history), sometimes corresponding to NumEntries
 	Unknown2   uint16 // Usually 0x1fff, sometimes 0x0000 (keys, history)
-	Unknown3   uint16 // Always 0x03ec
+	Unknown3   uint16 // Always 0x03ec, which is the number of entries that fit in the page.
 	NextOffset uint16 // Byte offset of where to insert the next entry. Relative to the start of index entries, usually zero for empty pages.
 	PageIndex  uint32 // |
 	NextPage   uint32 // |- reflects the values from PageIndex and NextPage, except empty tables are 0x1ffffff8
 
-	// Some kind of flags
-	Unknown5        uint32 // Always 0x03ffffff
-	Unknown6        uint32 // Always 0x00000000
-	NumEntries      uint16 `struc:"sizeof=IndexEntries"` // Number of index entries. The actual number of pages with flag 0x34 might be (one) higher than this value.
-	FirstEmptyEntry uint16 // Points to the first offset of index entries where the index value equals 0x1ffffff8. If none, then this value is 0x1fff. Garbage collector?
-
-	IndexEntries []uint32
-
-	// Next part is the indexes. This seems to be implemented as a heap,
-	// Filling up the rest of the page.
-	// Most of the heap is filled with 0x1fffffff8.
-	// The heap ends with 18 bytes which are observed to be always zero (???)
-
+	// Always 0x03ffffff in rekordbox exports.
+	// Tables with more data pages than fit in one index page continue the index on the page pointed to by this field.
+	// This link is a rex convention only: rekordbox has not been seen writing it,
+	// and players have not been shown to follow it.
+	NextIndexPage uint32
+	Unknown6      uint32 // Always 0x00000000
+	NumEntries    uint16 `struc:"sizeof=IndexEntries"` // Number of index entries. The actual number of pages with flag 0x34 might be (one) higher than this value.
+	// Thought to point to the first entry among the used ones that equals 0x1ffffff8. If none, then this value is 0x1fff. Garbage collector?
+	// Rekordbox exports have 0x1fff here both in empty indexes and in indexes with entries.
+	FirstEmptyEntry uint16
+
+	// Each entry is assumed to be the index of a data page shifted left by three bits, see IndexEntry().
+	// The three lowest bits are usually zero, but have been observed as 011 in the KEYS table.
+	// The rest of the page is filled with 0x1ffffff8, and ends with 20 bytes that are always zero.
+	//
 	// Changing/deleting single entry in the table results in this change on the first line of indices:
 	// -00001030: ffff ff03 0000 0000 0000 ff1f f8ff ff1f  ................
 	// ------ CHANGE 1
@@ -52,65 +68,59 @@ type IndexHeader struct {
 	// ------ CHANGE 2
 	// +00001030: ffff ff03 0000 0000 0200 ff1f 8801 0000  ................
 	// +00001040: 1000 0000 f8ff ff1f f8ff ff1f f8ff ff1f  ................
-	//
-	// Renaming an entry in the table results in this change on the first line of indices.
-	// -00001020: ffff ff03 0000 0000 0000 ff1f f8ff ff1f  ................
-	// +00001020: ffff ff03 0000 0000 0100 ff1f 8b01 0000  ................
+	IndexEntries []uint32
+}
 
-	// Deleting an entry can also not trigger the index.
-	// Simply the bit is flipped in the row table on the page.
-	//
-	// Theories on data
-	//
-	// - bit mask, seems to be at most 11 bits long = 2048.
-	//   for TRACKS and most other tables, there seem to be eight bits in use. The three least significant bits are always zero.
-	//   for KEYS, the three LSB have been observed to be 011.
-	//
-	// - the largest auto-incrementing ID for a field?
-	// - the values seem to be mostly increasing, but also decreasing
-	// - always greater than the highest ID of any track on that page
-	//
-	// bin(0x10)       // '0b000010000'
-	// bin(0x1b0)      // '0b110110000'
-	// bin(0x1a8)      // '0b110101000'
-	// bin(0x180)      // '0b110000000'
-	// bin(0x1ffffff8) // '0b11111111111111111111111111000'
-	//
-	// bin(0x1ab)      // '0b110101011'
-	// Observation
-	//
-	// The KEYS table can have both camelot and standard notation.
-	// id and id2 are increasing monotonically.
-	// on the keys table the index is
+// Returns the index entry referencing a data page.
+// This encoding is a guess: it fits the entries seen in hexdumps of modified rekordbox exports,
+// but it has not been checked against a rekordbox file with populated indexes.
+func IndexEntry(pageIndex uint32) uint32 {
+	return pageIndex << 3
+}
+
+// Returns the data page referenced by an index entry.
+func IndexEntryPage(entry uint32) uint32 {
+	return entry >> 3
+}
+
+// Add a reference to a data page to the index.
+// Returns false if the index page is full.
+func (page *Index) AddEntry(pageIndex uint32) bool {
+	if len(page.IndexEntries) >= IndexCapacity {
+		return false
+	}
+	page.IndexEntries = append(page.IndexEntries, IndexEntry(pageIndex))
+	return true
 }
 
 func (page *Index) MarshalBinary() ([]byte, error) {
 	buf := &bytes.Buffer{}
 
-	page.Header.PageFlags = 0x64
+	page.Header.PageFlags = FlagsIndex
 	page.Header.FreeSize = 0
 	page.Header.NextHeapWriteOffset = 0
 
-	// I believe this combination of values means "no index entries for this table"
 	page.IndexHeader.PageIndex = page.Header.PageIndex
 	// page.IndexHeader.NextPage = page.Header.NextPage
 	page.IndexHeader.Unknown1 = 0x1fff
 	page.IndexHeader.Unknown2 = 0x1fff
-	page.IndexHeader.Unknown3 = 0x03ec
-	page.IndexHeader.Unknown5 = 0x03ffffff
-	page.IndexHeader.FirstEmptyEntry = 0x1fff
+	page.IndexHeader.Unknown3 = IndexCapacity
 
-	// Empty bitmask
+	// New entries are written after the existing ones.
+	numEntries := len(page.IndexEntries)
+	page.IndexHeader.NumEntries = uint16(numEntries)
+	page.IndexHeader.NextOffset = uint16(numEntries * 4)
+	page.IndexHeader.FirstEmptyEntry = noIndexEntry
 
-	hp := heap.New(TypicalPageSize - IndexHeaderSize)
-	err := marshal.PackInto(hp.BottomWriter(), [20]byte{})
+	hp := heap.New(TypicalPageSize - IndexHeaderSize - numEntries*4)
+	err := marshal.PackInto(hp.BottomWriter(), [indexFooterSize]byte{})
 	if err != nil {
 		return nil, err
 	}
 
-	// Instead of zero-filling, we fill with a known constant.
+	// Unused entries are filled with a known constant.
 	for err == nil {
-		err = marshal.PackInto(hp.TopWriter(), uint32(0x1ffffff8))
+		err = marshal.PackInto(hp.TopWriter(), uint32(EmptyIndexEntry))
 	}
 	if err != io.ErrShortWrite {
 		return nil, err
@@ -137,5 +147,8 @@ func NewIndex(pageType Type) *Index {
 		Header: Header{
 			Type: pageType,
 		},
+		IndexHeader: IndexHeader{
+			NextIndexPage: NoPage,
+		},
 	}
 }
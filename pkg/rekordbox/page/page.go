@@ -3,7 +3,9 @@ package page
 import (
 	`bytes`
 	`encoding`
+	`errors`
 	`io`
+	`math`
 
 	`github.com/ambientsound/rex/pkg/marshal`
 	`github.com/ambientsound/rex/pkg/rekordbox/heap`
@@ -64,8 +66,8 @@ type DataHeader struct {
 	// Equal to the number of rows in the COLORS and COLUMNS and UNKNOWN17-18 tables.
 	Unknown5 uint16
 	// The value 0x1fff is observed, and when it is, there are certainly deleted rows in the page.
-	// Otherwise, a small number. I believe this might be a bitmask, 10 bits?
-	// First deletable row?
+	// Otherwise, a small number, or the number of rows when there are too many for NumRowsSmall.
+	// See NumRows().
 	NumRowsLarge uint16
 	Unknown6     uint16 // Always zero?
 	Unknown7     uint16 // Always zero?
@@ -87,23 +89,62 @@ type Header struct {
 
 	// 16 bytes
 	// Transaction increments every time a transaction is made, it follows the value in the global header.
-	Transaction  uint32 // Updated when the page is written. For index pages, this value seems to be 1 until the index is changed.
-	Unknown2     uint32 // always 00 00 00 00, but not indices?
-	NumRowsSmall uint8  // 0x20, 0x09 (doesn't correspond to num playlist rows, which is 2)
-	// U3 can maybe indicate the number of active rows in the table?
-	// It increases by 0x20 for each active row.
-	// This does not hold true for the COLORS table, where this value is always zero.
-	// Also not for the COLUMNS table, where we have 27 entries and this value is 0x60.
+	Transaction uint32 // Updated when the page is written. For index pages, this value seems to be 1 until the index is changed.
+	Unknown2    uint32 // always 00 00 00 00, but not indices?
+	// NumRowsSmall, Unknown3 and Unknown4 form a 24-bit little endian number.
+	// The lower 13 bits count the rows in the page, including deleted rows,
+	// and the upper 11 bits count the active rows.
+	NumRowsSmall uint8 // 0x20, 0x09 (doesn't correspond to num playlist rows, which is 2)
+	// Increases by 0x20 for each active row, and overflows into Unknown4.
+	// This looked wrong for the COLORS table, where this value is always zero,
+	// and for the COLUMNS table, where we have 27 entries and this value is 0x60.
+	// Both follow from the active row count: 8 rows are 0x100, and 27 rows are 0x360.
 	Unknown3 uint8 // changed from 0x60 to 0x40 when an entry was deleted.
 	// Zero for tracks, albums, artists, genres, lables, artwork, history.
 	// 0x01 for color pages.
 	// 0x02 for Unknown17-18.
 	// 0x03 for columns.
-	// Higher values for other tables.
+	// Higher values for pages with more than seven active rows, e.g. 12 for 101 rows.
 	Unknown4            uint8
 	PageFlags           uint8  // 0x64 for index tables. 0x24 and 0x34 for data page.
-	FreeSize            uint16 // total size 4050 (plus 40 bytes header, 6 missing?). Always zero on index tables.
-	NextHeapWriteOffset uint16 // total size 4050. Always zero on index tables.
+	FreeSize            uint16 // Heap size minus used space and the row index, see IndexSize(). Always zero on index tables.
+	NextHeapWriteOffset uint16 // Used space at the start of the heap. Always zero on index tables.
+}
+
+// Page flags.
+const (
+	// Data page that is not referenced by the table index.
+	FlagsData = 0x24
+	// Data page referenced by the table index.
+	// In rekordbox exports, these are mostly found in large tables like TRACKS, but also PlaylistTree, History and Keys.
+	// Rex only indexes tables with more than one data page.
+	FlagsDataIndexed = 0x34
+	FlagsIndex       = 0x64
+)
+
+var ErrRowNotFound = errors.New("row not found")
+
+// NumRowsLarge has this value in some pages with deleted rows, and it is not a row count then.
+const numRowsLargeInvalid = 0x1fff
+
+const packedRowsBits = 13
+const packedRowsMask = 1<<packedRowsBits - 1
+
+func (h *Header) packedRowCounts() uint32 {
+	return uint32(h.NumRowsSmall) | uint32(h.Unknown3)<<8 | uint32(h.Unknown4)<<16
+}
+
+func (h *Header) setPackedRowCounts(numRows, activeRows int) {
+	packed := uint32(numRows)&packedRowsMask | uint32(activeRows)<<packedRowsBits
+	h.NumRowsSmall = uint8(packed)
+	h.Unknown3 = uint8(packed >> 8)
+	h.Unknown4 = uint8(packed >> 16)
+}
+
+// Number of active rows, as counted in the page header.
+// This should equal ActiveRows() of the page.
+func (h *Header) NumActiveRows() int {
+	return int(h.packedRowCounts() >> packedRowsBits)
 }
 
 type Row interface {
@@ -115,7 +156,8 @@ type Row interface {
 func NewPage(pageType Type) *Data {
 	return &Data{
 		Header: Header{
-			Type: pageType,
+			Type:      pageType,
+			PageFlags: FlagsData,
 		},
 		heap: heap.New(TypicalPageSize - DataHeaderSize),
 	}
@@ -128,25 +170,19 @@ func (page *Data) MarshalBinary() ([]byte, error) {
 	// page.NumRowsLarge = 0x1fff
 	// page.DataHeader.Unknown5 = 0x1fff // 0x1 // seems to be the row count for this table?
 	page.DataHeader.Unknown5 = 1
-	page.Header.Unknown4 = 0
 	// page.DataHeader.Unknown5 = uint16(page.Header.NumRowsSmall)
 	// page.Header.NumRowsSmall = uint8(page.DataHeader.NumRowsLarge) // I wonder what happens when this overflows.
 
-	// In files exported by rekordbox, free + used = 4050.
-	// This does not make sense, as the data header size is 40 bytes, and indeed this is where the heap starts.
-	// Does that mean that six bytes are padded on top?
-	// page.Header.FreeSize = uint16(page.heap.Free())
-	// page.Header.NextHeapWriteOffset = uint16(page.heap.Size()) - page.Header.FreeSize
-	// page.Header.FreeSize -= 6
-
-	// For normal pages, this value is 0x24.
-	// The value 0x34 is also observed mostly on Track tables (seen in PlaylistTree, History, Keys).
-	// In a big file, around a third of the entries have the 0x10 bit set.
-	//
-	// Pages with 0x34 seems to have some connection with indexes.
-	// The number of non-0x1ffffff8 index entries seem to correspond with the number of 0x34 tables.
-	// Keys=0x19b, PlaylistTree=0x80, History=0x140
-	page.Header.PageFlags = 0x34
+	// In files exported by rekordbox, free + used = 4050 on pages with a single row.
+	// The heap is 4056 bytes, and the missing six bytes are the row index:
+	// two bytes for the row and four for its row set. See IndexSize().
+	// The free size is kept up to date by Insert and Update.
+
+	// Pages created by NewPage are unreferenced data pages,
+	// and are flagged as referenced when they are added to the table index.
+	if page.Header.PageFlags == 0 {
+		page.Header.PageFlags = FlagsData
+	}
 
 	err := marshal.PackInto(buf, &page.Header)
 	if err != nil {
@@ -187,7 +223,7 @@ func (page *Data) UnmarshalBinary(data []byte) error {
 	}
 
 	// Read row tables from the end of the buffer
-	remain := int(page.NumRowsSmall)
+	remain := page.NumRows()
 	sz := len(raw)
 	for remain > 0 {
 		sz -= rowsetLength
@@ -200,7 +236,18 @@ func (page *Data) UnmarshalBinary(data []byte) error {
 		page.RowSets = append(page.RowSets, rowset)
 	}
 
-	page.heap, err = heap.Load(raw, len(page.RowSets)*rowsetLength)
+	// Only the part of the heap that is in use is loaded,
+	// so that more rows can be inserted into the page later.
+	rowsetBytes := len(page.RowSets) * rowsetLength
+	used := int(page.NextHeapWriteOffset)
+	if used > len(raw)-rowsetBytes {
+		used = len(raw) - rowsetBytes
+	}
+	page.heap = heap.New(len(raw))
+	err = page.heap.WriteTop(raw[:used])
+	if err == nil && rowsetBytes > 0 {
+		err = page.heap.WriteBottom(raw[len(raw)-rowsetBytes:])
+	}
 
 	return err
 }
@@ -224,8 +271,30 @@ func (page *Data) ActiveRows() (numRows int) {
 	return
 }
 
+// Number of rows in the page, including deleted rows.
+//
+// As in the Kaitai Struct description of the format, NumRowsLarge is used
+// when it is larger than NumRowsSmall and not 0x1fff.
+// Otherwise the row count is read from the lower 13 bits of the packed row counts,
+// which is NumRowsSmall for pages with less than 256 rows.
+func (page *Data) NumRows() int {
+	if page.NumRowsLarge > uint16(page.NumRowsSmall) && page.NumRowsLarge != numRowsLargeInvalid {
+		return int(page.NumRowsLarge)
+	}
+	return int(page.packedRowCounts() & packedRowsMask)
+}
+
+// Update the row counts in the page headers.
+// NumRowsLarge is only written when the row count does not fit in NumRowsSmall.
+func (page *Data) setNumRows(numRows, activeRows int) {
+	page.Header.setPackedRowCounts(numRows, activeRows)
+	if numRows > math.MaxUint8 {
+		page.DataHeader.NumRowsLarge = uint16(numRows)
+	}
+}
+
 func (page *Data) HeapPositions() []RowReference {
-	rowsToParse := page.NumRowsSmall
+	rowsToParse := page.NumRows()
 	refs := make([]RowReference, 0)
 
 	for _, rs := range page.RowSets {
@@ -245,43 +314,33 @@ func (page *Data) HeapPositions() []RowReference {
 }
 
 func (page *Data) Insert(row Row) error {
-	const align = 4
-
-	row.SetIndexShift(uint16(page.Header.NumRowsSmall) * 0x20)
+	numRows := page.NumRows()
+	row.SetIndexShift(uint16(numRows) * 0x20)
 
 	data, err := row.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	heapPosition := uint16(page.heap.CursorTop())
+	index := numRows % rowsInRowSet
 
-	err = page.heap.WriteTop(data)
-	if err != nil {
-		return err
+	// A new row set must be allocated for every 16 rows.
+	reserve := 0
+	if index == 0 {
+		reserve = rowsetLength
 	}
 
-	err = page.heap.AlignTop(align)
+	heapPosition, err := page.writeRow(data, reserve)
 	if err != nil {
 		return err
 	}
 
-	page.Header.NextHeapWriteOffset = uint16(page.heap.CursorTop())
-	page.Header.FreeSize = uint16(page.heap.Free())
-
-	index := page.Header.NumRowsSmall % 16
-
 	if index == 0 {
 		page.RowSets = append(page.RowSets, &RowSet{
 			Positions:       make([]uint16, 16),
 			ActiveRows:      0,
 			LastWrittenRows: 0,
 		})
-
-		err = page.writeRowsets()
-		if err != nil {
-			return err
-		}
 	}
 
 	rowsetNum := len(page.RowSets) - 1
@@ -295,12 +354,122 @@ func (page *Data) Insert(row Row) error {
 		return err
 	}
 
-	page.Header.NumRowsSmall++
-	page.Header.Unknown3 += 0x20
+	page.setNumRows(numRows+1, page.NumActiveRows()+1)
+	page.updateFreeSize()
 
 	return nil
 }
 
+// Mark a row as deleted.
+// The row data is left in the heap, and the row index is never re-used.
+func (page *Data) Delete(rowIndex int) error {
+	rs, bit, err := page.rowBit(rowIndex)
+	if err != nil {
+		return err
+	}
+
+	rs.ActiveRows &^= bit
+	rs.LastWrittenRows |= bit
+
+	err = page.writeRowsets()
+	if err != nil {
+		return err
+	}
+
+	// Don't wrap around if the active row count is wrong.
+	if active := page.NumActiveRows(); active > 0 {
+		page.setNumRows(page.NumRows(), active-1)
+	}
+
+	return nil
+}
+
+// Replace a row with new data.
+// The replacement is written into the free space of the heap, and the row index is pointed to it.
+// Returns io.ErrShortWrite if there is not enough free space in the page.
+func (page *Data) Update(rowIndex int, row Row) error {
+	rs, bit, err := page.rowBit(rowIndex)
+	if err != nil {
+		return err
+	}
+
+	row.SetIndexShift(uint16(rowIndex) * 0x20)
+
+	data, err := row.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	heapPosition, err := page.writeRow(data, 0)
+	if err != nil {
+		return err
+	}
+
+	// Like deleted rows, updated rows are added to the rows affected by previous operations.
+	rs.LastWrittenRows |= bit
+	rs.Positions[rowIndex%rowsInRowSet] = heapPosition
+	page.updateFreeSize()
+
+	return page.writeRowsets()
+}
+
+// Returns the row set and presence bit of an active row.
+func (page *Data) rowBit(rowIndex int) (*RowSet, uint16, error) {
+	if rowIndex < 0 || rowIndex >= page.NumRows() {
+		return nil, 0, ErrRowNotFound
+	}
+	rs := page.RowSets[rowIndex/rowsInRowSet]
+	bit := uint16(1 << (rowIndex % rowsInRowSet))
+	if rs.ActiveRows&bit == 0 {
+		return nil, 0, ErrRowNotFound
+	}
+	return rs, bit, nil
+}
+
+// Size of the row index as counted in the page header.
+// In files exported by rekordbox, free + used space + index size equals the heap size,
+// where the index size counts two bytes for each row and four bytes for each row set.
+func (page *Data) IndexSize() int {
+	return page.NumRows()*2 + len(page.RowSets)*4
+}
+
+// Size of the heap, between the page headers and the end of the page.
+func (page *Data) HeapSize() int {
+	return page.heap.Size()
+}
+
+func (page *Data) updateFreeSize() {
+	page.Header.FreeSize = uint16(page.heap.Size() - page.heap.CursorTop() - page.IndexSize())
+}
+
+// Write row data to the top of the heap, and return its heap position.
+// The reserved space must be available in the heap after the row is written.
+func (page *Data) writeRow(data []byte, reserve int) (uint16, error) {
+	const align = 4
+
+	heapPosition := uint16(page.heap.CursorTop())
+
+	// Check that both the row and the reserved space fits in the page before modifying anything.
+	required := len(data) + (align-(len(data)+int(heapPosition))%align)%align + reserve
+	if required > page.heap.Free() {
+		return 0, io.ErrShortWrite
+	}
+
+	err := page.heap.WriteTop(data)
+	if err != nil {
+		return 0, err
+	}
+
+	err = page.heap.AlignTop(align)
+	if err != nil {
+		return 0, err
+	}
+
+	page.Header.NextHeapWriteOffset = uint16(page.heap.CursorTop())
+
+	return heapPosition, nil
+}
+
 func (page *Data) writeRowsets() error {
 	page.heap.ResetBottom()
 	for rs := range page.RowSets {
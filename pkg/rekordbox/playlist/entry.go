@@ -14,5 +14,9 @@ func (entry *Entry) MarshalBinary() ([]byte, error) {
 	return marshal.Pack(entry)
 }
 
+func (entry *Entry) UnmarshalBinary(data []byte) error {
+	return marshal.Unpack(entry, data)
+}
+
 func (entry *Entry) SetIndexShift(shift uint16) {
 }
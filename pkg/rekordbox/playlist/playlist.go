@@ -50,5 +50,16 @@ func (playlist *Playlist) MarshalBinary() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+func (playlist *Playlist) UnmarshalBinary(data []byte) error {
+	err := struc.UnpackWithOptions(bytes.NewReader(data), &playlist.PlaylistHeader, &struc.Options{
+		Order: binary.LittleEndian,
+	})
+	if err != nil {
+		return err
+	}
+	playlist.Name, err = dstring.UnmarshalBinary(data[20:])
+	return err
+}
+
 func (playlist *Playlist) SetIndexShift(shift uint16) {
 }
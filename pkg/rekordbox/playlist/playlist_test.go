@@ -24,3 +24,28 @@ func TestPlaylist_MarshalBinary(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte{}, data)
 }
+
+func TestPlaylist_UnmarshalBinary(t *testing.T) {
+	p := &playlist.Playlist{}
+	err := p.UnmarshalBinary([]byte{
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+		0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0d, 0x48, 0x6f, 0x75,
+		0x73, 0x65,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), p.ParentId)
+	assert.Equal(t, uint32(1), p.SortOrder)
+	assert.Equal(t, uint32(5), p.Id)
+	assert.Equal(t, "House", p.Name)
+}
+
+func TestEntry_UnmarshalBinary(t *testing.T) {
+	e := &playlist.Entry{}
+	err := e.UnmarshalBinary([]byte{
+		0x01, 0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, playlist.Entry{EntryIndex: 1, TrackID: 42, PlaylistID: 5}, *e)
+}
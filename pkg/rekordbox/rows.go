@@ -0,0 +1,88 @@
+package rekordbox
+
+// Registry of row types, used to decode the rows of every table in a PDB file.
+
+import (
+	`encoding`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/album`
+	`github.com/ambientsound/rex/pkg/rekordbox/artist`
+	`github.com/ambientsound/rex/pkg/rekordbox/artwork`
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/ambientsound/rex/pkg/rekordbox/column`
+	`github.com/ambientsound/rex/pkg/rekordbox/genre`
+	`github.com/ambientsound/rex/pkg/rekordbox/history`
+	`github.com/ambientsound/rex/pkg/rekordbox/key`
+	`github.com/ambientsound/rex/pkg/rekordbox/label`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/playlist`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+	`github.com/ambientsound/rex/pkg/rekordbox/unknown17`
+	`github.com/ambientsound/rex/pkg/rekordbox/unknown18`
+)
+
+// Returns an empty row that data can be unmarshaled into.
+type RowConstructor func() encoding.BinaryUnmarshaler
+
+var rowTypes = map[page.Type]RowConstructor{
+	page.Type_Tracks: func() encoding.BinaryUnmarshaler {
+		return &track.Track{}
+	},
+	page.Type_Genres: func() encoding.BinaryUnmarshaler {
+		return &genre.Genre{}
+	},
+	page.Type_Artists: func() encoding.BinaryUnmarshaler {
+		return &artist.Artist{}
+	},
+	page.Type_Albums: func() encoding.BinaryUnmarshaler {
+		return &album.Album{}
+	},
+	page.Type_Labels: func() encoding.BinaryUnmarshaler {
+		return &label.Label{}
+	},
+	page.Type_Keys: func() encoding.BinaryUnmarshaler {
+		return &key.Key{}
+	},
+	page.Type_Colors: func() encoding.BinaryUnmarshaler {
+		return &color.Color{}
+	},
+	page.Type_PlaylistTree: func() encoding.BinaryUnmarshaler {
+		return &playlist.Playlist{}
+	},
+	page.Type_PlaylistEntries: func() encoding.BinaryUnmarshaler {
+		return &playlist.Entry{}
+	},
+	page.Type_HistoryPlaylists: func() encoding.BinaryUnmarshaler {
+		return &history.Playlist{}
+	},
+	page.Type_HistoryEntries: func() encoding.BinaryUnmarshaler {
+		return &history.Entry{}
+	},
+	page.Type_Artwork: func() encoding.BinaryUnmarshaler {
+		return &artwork.Artwork{}
+	},
+	page.Type_Columns: func() encoding.BinaryUnmarshaler {
+		return &column.Column{}
+	},
+	page.Type_Unknown17: func() encoding.BinaryUnmarshaler {
+		return &unknown17.Unknown17{}
+	},
+	page.Type_Unknown18: func() encoding.BinaryUnmarshaler {
+		return &unknown18.Unknown18{}
+	},
+}
+
+// Register the row type of a table, replacing any previously registered type.
+func RegisterRow(pageType page.Type, constructor RowConstructor) {
+	rowTypes[pageType] = constructor
+}
+
+// Returns an empty row for the given table,
+// or nil if the rows of that table can not be decoded.
+func NewRow(pageType page.Type) encoding.BinaryUnmarshaler {
+	constructor := rowTypes[pageType]
+	if constructor == nil {
+		return nil
+	}
+	return constructor()
+}
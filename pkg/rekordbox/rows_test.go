@@ -0,0 +1,18 @@
+package rekordbox_test
+
+import (
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+	`github.com/stretchr/testify/assert`
+)
+
+func TestNewRow(t *testing.T) {
+	assert.IsType(t, &track.Track{}, rekordbox.NewRow(page.Type_Tracks))
+	assert.Nil(t, rekordbox.NewRow(page.Type_Unknown9))
+
+	// Every call returns a new row.
+	assert.NotSame(t, rekordbox.NewRow(page.Type_Tracks), rekordbox.NewRow(page.Type_Tracks))
+}
@@ -50,6 +50,7 @@ const (
 	FileTypeM4A     FileType = 0x4
 	FileTypeFLAC    FileType = 0x5
 	FileTypeWAV     FileType = 0xb
+	FileTypeAIFF    FileType = 0xc
 )
 
 // All numerical values go here.
@@ -169,10 +170,14 @@ func (t *Track) UnmarshalBinary(data []byte) error {
 		}
 		if int(offset) >= len(data) {
 			err = fmt.Errorf("heap pointer is past dataset")
+			return
 		}
 		*dst, err = dstring.UnmarshalBinary(data[offset:])
 	}
 
+	if err == nil && int(t.StringOffsets.Isrc) < len(data) {
+		t.Isrc, err = dstring.UnmarshalIsrc(data[t.StringOffsets.Isrc:])
+	}
 	load(&t.Composer, t.StringOffsets.Composer)
 	load(&t.KeyAnalyzed, t.StringOffsets.Num1)
 	load(&t.PhraseAnalyzed, t.StringOffsets.Num2)
@@ -221,9 +226,6 @@ func (t *Track) MarshalBinary() ([]byte, error) {
 	t.Header.Unnamed7 = 0x758a
 	t.Header.Unnamed8 = 0x57a2
 
-	// Usually ON
-	t.AutoloadHotcues = "ON"
-
 	err = binary.Write(buf, binary.LittleEndian, t.Header)
 	if err != nil {
 		return nil, err
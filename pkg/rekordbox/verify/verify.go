@@ -0,0 +1,386 @@
+package verify
+
+// Check that a PDB file follows the rules known about its structure.
+
+import (
+	`encoding`
+	`encoding/binary`
+	`fmt`
+	`reflect`
+
+	`github.com/ambientsound/rex/pkg/marshal`
+	`github.com/ambientsound/rex/pkg/rekordbox`
+	`github.com/ambientsound/rex/pkg/rekordbox/album`
+	`github.com/ambientsound/rex/pkg/rekordbox/artist`
+	`github.com/ambientsound/rex/pkg/rekordbox/artwork`
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/genre`
+	`github.com/ambientsound/rex/pkg/rekordbox/history`
+	`github.com/ambientsound/rex/pkg/rekordbox/key`
+	`github.com/ambientsound/rex/pkg/rekordbox/label`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/playlist`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+)
+
+// A rule broken by the file.
+type Problem struct {
+	Table   page.Type
+	Page    uint32 // Zero if the problem does not concern a single page.
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Page == 0 {
+		return fmt.Sprintf("%s: %s", p.Table.String()[5:], p.Message)
+	}
+	return fmt.Sprintf("%s page 0x%x: %s", p.Table.String()[5:], p.Page, p.Message)
+}
+
+// A decoded row and the page it was found on.
+type row struct {
+	page uint32
+	data encoding.BinaryUnmarshaler
+}
+
+type verifier struct {
+	db       *dbengine.DbEngine
+	problems []Problem
+	owners   map[uint32]page.Type // Tables that pages belong to.
+	rows     map[page.Type][]row
+}
+
+// Check page chains, page headers, row indexes and rows of all tables,
+// and that rows referencing other rows by ID point to existing rows.
+// Returns the problems found, or an empty list if the file is sound.
+func Verify(db *dbengine.DbEngine) []Problem {
+	v := &verifier{
+		db:       db,
+		problems: make([]Problem, 0),
+		owners:   make(map[uint32]page.Type),
+		rows:     make(map[page.Type][]row),
+	}
+
+	if int(db.Globals.NumTables) != len(db.Globals.Pointers) {
+		v.report(0, 0, "file header lists %d tables, but has %d table pointers", db.Globals.NumTables, len(db.Globals.Pointers))
+	}
+	tables := make(map[page.Type]bool)
+	for _, ptr := range db.Globals.Pointers {
+		if tables[ptr.Type] {
+			v.report(ptr.Type, 0, "table is listed more than once in the file header")
+			continue
+		}
+		tables[ptr.Type] = true
+		v.verifyTable(ptr.Type, ptr.FirstPage, ptr.LastPage, ptr.EmptyCandidate)
+	}
+
+	v.verifyReferences()
+
+	return v.problems
+}
+
+func (v *verifier) report(table page.Type, pageIndex uint32, format string, args ...any) {
+	v.problems = append(v.problems, Problem{
+		Table:   table,
+		Page:    pageIndex,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Mark a page as belonging to a table.
+// Returns false if the page is out of bounds or belongs to another table.
+func (v *verifier) claim(table page.Type, pageIndex uint32) bool {
+	if pageIndex == 0 || pageIndex >= v.db.Globals.NextUnusedPage {
+		v.report(table, 0, "link to page 0x%x, outside of the allocated pages", pageIndex)
+		return false
+	}
+	if owner, found := v.owners[pageIndex]; found {
+		if owner == table {
+			v.report(table, pageIndex, "page is linked to more than once")
+		} else {
+			v.report(table, pageIndex, "page also belongs to table %s", owner.String()[5:])
+		}
+		return false
+	}
+	v.owners[pageIndex] = table
+	return true
+}
+
+func (v *verifier) readIndex(table page.Type, pageIndex uint32) *page.Index {
+	data, err := v.db.ReadPage(pageIndex)
+	if err != nil {
+		v.report(table, pageIndex, "read index page: %s", err)
+		return nil
+	}
+	index := &page.Index{}
+	err = marshal.Unpack(index, data)
+	if err != nil {
+		v.report(table, pageIndex, "decode index page: %s", err)
+		return nil
+	}
+	if index.PageFlags != page.FlagsIndex {
+		v.report(table, pageIndex, "index page has flags 0x%02x", index.PageFlags)
+	}
+	if index.Header.Type != table {
+		v.report(table, pageIndex, "index page belongs to table %s", index.Header.Type.String()[5:])
+	}
+	if index.Header.PageIndex != pageIndex {
+		v.report(table, pageIndex, "index page has page index 0x%x", index.Header.PageIndex)
+	}
+	if int(index.NextOffset) != len(index.IndexEntries)*4 {
+		v.report(table, pageIndex, "next index offset is %d, expected %d", index.NextOffset, len(index.IndexEntries)*4)
+	}
+	return index
+}
+
+func (v *verifier) readData(table page.Type, pageIndex uint32) *page.Data {
+	data, err := v.db.ReadPage(pageIndex)
+	if err != nil {
+		v.report(table, pageIndex, "read data page: %s", err)
+		return nil
+	}
+	pg := &page.Data{}
+	err = pg.UnmarshalBinary(data)
+	if err != nil {
+		v.report(table, pageIndex, "decode data page: %s", err)
+		return nil
+	}
+	return pg
+}
+
+// Follow the index and data page chains of a table, and check every page.
+func (v *verifier) verifyTable(table page.Type, firstPage, lastPage, emptyCandidate uint32) {
+	if !v.claim(table, firstPage) {
+		return
+	}
+	index := v.readIndex(table, firstPage)
+	if index == nil {
+		return
+	}
+
+	// Index entries are spread over the first index page and its overflow pages.
+	entries := append([]uint32{}, index.IndexEntries...)
+	for overflow := index; overflow.NextIndexPage != page.NoPage; {
+		if !v.claim(table, overflow.NextIndexPage) {
+			break
+		}
+		overflow = v.readIndex(table, overflow.NextIndexPage)
+		if overflow == nil {
+			break
+		}
+		entries = append(entries, overflow.IndexEntries...)
+	}
+
+	if emptyCandidate == 0 || emptyCandidate >= v.db.Globals.NextUnusedPage {
+		v.report(table, 0, "empty candidate page 0x%x is outside of the allocated pages", emptyCandidate)
+	} else if owner, found := v.owners[emptyCandidate]; found {
+		v.report(table, 0, "empty candidate page 0x%x belongs to table %s", emptyCandidate, owner.String()[5:])
+	}
+
+	if firstPage == lastPage {
+		if index.Header.NextPage != emptyCandidate {
+			v.report(table, firstPage, "empty table links to page 0x%x instead of the empty candidate 0x%x", index.Header.NextPage, emptyCandidate)
+		}
+		if len(entries) > 0 {
+			v.report(table, firstPage, "empty table has %d index entries", len(entries))
+		}
+		return
+	}
+
+	dataPages := make(map[uint32]*page.Data)
+	for next := index.Header.NextPage; ; {
+		if !v.claim(table, next) {
+			v.report(table, 0, "page chain does not reach the last page 0x%x", lastPage)
+			break
+		}
+		pg := v.readData(table, next)
+		if pg == nil {
+			v.report(table, 0, "page chain does not reach the last page 0x%x", lastPage)
+			break
+		}
+		v.verifyPage(table, next, pg)
+		dataPages[next] = pg
+		if next == lastPage {
+			if pg.NextPage != emptyCandidate {
+				v.report(table, next, "last page links to page 0x%x instead of the empty candidate 0x%x", pg.NextPage, emptyCandidate)
+			}
+			break
+		}
+		next = pg.NextPage
+	}
+
+	for _, entry := range entries {
+		if entry == page.EmptyIndexEntry {
+			v.report(table, firstPage, "empty index entry among the used entries")
+			continue
+		}
+		pageIndex := page.IndexEntryPage(entry)
+		pg, found := dataPages[pageIndex]
+		if !found {
+			v.report(table, firstPage, "index entry 0x%x references page 0x%x, which is not a data page of the table", entry, pageIndex)
+			continue
+		}
+		if pg.PageFlags != page.FlagsDataIndexed {
+			v.report(table, pageIndex, "page is referenced by the index, but has flags 0x%02x", pg.PageFlags)
+		}
+	}
+}
+
+// Check the headers, row index and rows of a data page.
+func (v *verifier) verifyPage(table page.Type, pageIndex uint32, pg *page.Data) {
+	switch pg.PageFlags {
+	case page.FlagsData, page.FlagsDataIndexed:
+	default:
+		v.report(table, pageIndex, "data page has flags 0x%02x", pg.PageFlags)
+	}
+	if pg.Header.Type != table {
+		v.report(table, pageIndex, "data page belongs to table %s", pg.Header.Type.String()[5:])
+	}
+	if pg.Header.PageIndex != pageIndex {
+		v.report(table, pageIndex, "data page has page index 0x%x", pg.Header.PageIndex)
+	}
+
+	used := int(pg.NextHeapWriteOffset)
+	if sum := int(pg.FreeSize) + used + pg.IndexSize(); sum != pg.HeapSize() {
+		v.report(table, pageIndex, "free size %d, used size %d and row index size %d add up to %d, not the heap size %d", pg.FreeSize, used, pg.IndexSize(), sum, pg.HeapSize())
+	}
+	if used+len(pg.RowSets)*36 > pg.HeapSize() {
+		v.report(table, pageIndex, "rows and row index overlap")
+	}
+
+	// Row sets are read according to the row count, so only their contents can be checked.
+	numRows := pg.NumRows()
+	if numRows > 0xff && uint8(numRows) != pg.NumRowsSmall {
+		v.report(table, pageIndex, "%d rows, but the small row count is %d", numRows, pg.NumRowsSmall)
+	}
+	if len(pg.RowSets) > 0 {
+		last := pg.RowSets[len(pg.RowSets)-1]
+		unused := numRows % 16
+		if unused > 0 && last.ActiveRows>>unused != 0 {
+			v.report(table, pageIndex, "rows past the row count of %d are marked as present", numRows)
+		}
+	}
+	if pg.NumActiveRows() != pg.ActiveRows() {
+		v.report(table, pageIndex, "header counts %d active rows, but %d rows are present", pg.NumActiveRows(), pg.ActiveRows())
+	}
+
+	for i, ref := range pg.HeapPositions() {
+		if !ref.Exists {
+			continue
+		}
+		if int(ref.HeapPosition) >= used {
+			v.report(table, pageIndex, "row %d at heap position 0x%x is outside of the used space", i, ref.HeapPosition)
+			continue
+		}
+		data := rekordbox.NewRow(table)
+		if data == nil {
+			continue
+		}
+		err := pg.UnmarshalRow(data, ref.HeapPosition)
+		if err != nil {
+			v.report(table, pageIndex, "row %d: %s", i, err)
+			continue
+		}
+		if t, ok := data.(*track.Track); ok {
+			v.verifyTrackStrings(pageIndex, i, t, used-int(ref.HeapPosition))
+		}
+		v.rows[table] = append(v.rows[table], row{page: pageIndex, data: data})
+	}
+}
+
+// Check that the string offsets of a track point past the fixed size part of the row,
+// and inside the used space of the page.
+func (v *verifier) verifyTrackStrings(pageIndex uint32, i int, t *track.Track, maxLen int) {
+	headerLen := binary.Size(t.Header) + binary.Size(t.StringOffsets)
+	offsets := reflect.ValueOf(t.StringOffsets)
+	for f := 0; f < offsets.NumField(); f++ {
+		offset := int(offsets.Field(f).Uint())
+		if offset < headerLen || offset >= maxLen {
+			v.report(page.Type_Tracks, pageIndex, "track %d: string %s at offset 0x%x is outside of the row", t.Id, offsets.Type().Field(f).Name, offset)
+		}
+	}
+}
+
+// Collect the IDs of rows in a table, and report duplicates.
+func (v *verifier) ids(table page.Type, id func(encoding.BinaryUnmarshaler) uint32) map[uint32]encoding.BinaryUnmarshaler {
+	ids := make(map[uint32]encoding.BinaryUnmarshaler)
+	for _, r := range v.rows[table] {
+		rowID := id(r.data)
+		if _, found := ids[rowID]; found {
+			v.report(table, r.page, "duplicate row ID %d", rowID)
+		}
+		ids[rowID] = r.data
+	}
+	return ids
+}
+
+// Check that rows referencing other rows by ID point to existing rows.
+// An ID of zero means no reference.
+func (v *verifier) verifyReferences() {
+	artists := v.ids(page.Type_Artists, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*artist.Artist).Id })
+	albums := v.ids(page.Type_Albums, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*album.Album).Id })
+	genres := v.ids(page.Type_Genres, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*genre.Genre).Id })
+	keys := v.ids(page.Type_Keys, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*key.Key).Id })
+	labels := v.ids(page.Type_Labels, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*label.Label).Id })
+	colors := v.ids(page.Type_Colors, func(r encoding.BinaryUnmarshaler) uint32 { return uint32(r.(*color.Color).ID) })
+	artworks := v.ids(page.Type_Artwork, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*artwork.Artwork).Id })
+	tracks := v.ids(page.Type_Tracks, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*track.Track).Id })
+	playlists := v.ids(page.Type_PlaylistTree, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*playlist.Playlist).Id })
+	histories := v.ids(page.Type_HistoryPlaylists, func(r encoding.BinaryUnmarshaler) uint32 { return r.(*history.Playlist).Id })
+
+	check := func(table page.Type, pageIndex uint32, what string, id uint32, field string, targets map[uint32]encoding.BinaryUnmarshaler) {
+		if id == 0 {
+			return
+		}
+		if _, found := targets[id]; !found {
+			v.report(table, pageIndex, "%s: %s %d not found", what, field, id)
+		}
+	}
+
+	for _, r := range v.rows[page.Type_Tracks] {
+		t := r.data.(*track.Track)
+		what := fmt.Sprintf("track %d", t.Id)
+		check(page.Type_Tracks, r.page, what, t.ArtistId, "ArtistId", artists)
+		check(page.Type_Tracks, r.page, what, t.ComposerId, "ComposerId", artists)
+		check(page.Type_Tracks, r.page, what, t.OriginalArtistId, "OriginalArtistId", artists)
+		check(page.Type_Tracks, r.page, what, t.RemixerId, "RemixerId", artists)
+		check(page.Type_Tracks, r.page, what, t.AlbumId, "AlbumId", albums)
+		check(page.Type_Tracks, r.page, what, t.GenreId, "GenreId", genres)
+		check(page.Type_Tracks, r.page, what, t.KeyId, "KeyId", keys)
+		check(page.Type_Tracks, r.page, what, t.LabelId, "LabelId", labels)
+		check(page.Type_Tracks, r.page, what, uint32(t.ColorId), "ColorId", colors)
+		check(page.Type_Tracks, r.page, what, t.ArtworkId, "ArtworkId", artworks)
+	}
+
+	for _, r := range v.rows[page.Type_Albums] {
+		a := r.data.(*album.Album)
+		check(page.Type_Albums, r.page, fmt.Sprintf("album %d", a.Id), a.ArtistId, "ArtistId", artists)
+	}
+
+	for _, r := range v.rows[page.Type_PlaylistTree] {
+		pl := r.data.(*playlist.Playlist)
+		what := fmt.Sprintf("playlist %d", pl.Id)
+		check(page.Type_PlaylistTree, r.page, what, pl.ParentId, "ParentId", playlists)
+		if parent, found := playlists[pl.ParentId]; found && parent.(*playlist.Playlist).RawIsFolder == 0 {
+			v.report(page.Type_PlaylistTree, r.page, "%s: parent %d is not a folder", what, pl.ParentId)
+		}
+	}
+
+	for _, r := range v.rows[page.Type_PlaylistEntries] {
+		entry := r.data.(*playlist.Entry)
+		what := fmt.Sprintf("playlist %d entry %d", entry.PlaylistID, entry.EntryIndex)
+		check(page.Type_PlaylistEntries, r.page, what, entry.TrackID, "TrackID", tracks)
+		check(page.Type_PlaylistEntries, r.page, what, entry.PlaylistID, "PlaylistID", playlists)
+		if pl, found := playlists[entry.PlaylistID]; found && pl.(*playlist.Playlist).RawIsFolder != 0 {
+			v.report(page.Type_PlaylistEntries, r.page, "%s: playlist is a folder", what)
+		}
+	}
+
+	for _, r := range v.rows[page.Type_HistoryEntries] {
+		entry := r.data.(*history.Entry)
+		what := fmt.Sprintf("history %d entry %d", entry.PlaylistID, entry.EntryIndex)
+		check(page.Type_HistoryEntries, r.page, what, entry.TrackID, "TrackID", tracks)
+		check(page.Type_HistoryEntries, r.page, what, entry.PlaylistID, "PlaylistID", histories)
+	}
+}
@@ -0,0 +1,111 @@
+package verify_test
+
+import (
+	`fmt`
+	`os`
+	`testing`
+
+	`github.com/ambientsound/rex/pkg/rekordbox/album`
+	`github.com/ambientsound/rex/pkg/rekordbox/artist`
+	`github.com/ambientsound/rex/pkg/rekordbox/color`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine`
+	`github.com/ambientsound/rex/pkg/rekordbox/dbengine/dbtest`
+	`github.com/ambientsound/rex/pkg/rekordbox/page`
+	`github.com/ambientsound/rex/pkg/rekordbox/playlist`
+	`github.com/ambientsound/rex/pkg/rekordbox/track`
+	`github.com/ambientsound/rex/pkg/rekordbox/verify`
+	`github.com/stretchr/testify/assert`
+)
+
+// Write a small export with the given playlist entries.
+func export(t *testing.T, entries []*playlist.Entry) *dbengine.DbEngine {
+	return dbtest.Export(t, func(db *dbengine.DbEngine) {
+		for _, row := range color.InitialDataset {
+			assert.NoError(t, db.InsertRow(page.Type_Colors, row))
+		}
+		assert.NoError(t, db.InsertRow(page.Type_Artists, &artist.Artist{Id: 1, Name: "Artist"}))
+		assert.NoError(t, db.InsertRow(page.Type_Albums, &album.Album{Id: 1, ArtistId: 1, Name: "Album"}))
+		for i := 1; i <= 40; i++ {
+			tr := &track.Track{
+				Title:    fmt.Sprintf("Track %d", i),
+				FilePath: fmt.Sprintf("/rex/%d.mp3", i),
+			}
+			tr.Id = uint32(i)
+			tr.ArtistId = 1
+			tr.AlbumId = 1
+			tr.ColorId = 2
+			assert.NoError(t, db.InsertRow(page.Type_Tracks, tr))
+		}
+		assert.NoError(t, db.InsertRow(page.Type_PlaylistTree, &playlist.Playlist{
+			PlaylistHeader: playlist.PlaylistHeader{Id: 1, RawIsFolder: 1},
+			Name:           "Folder",
+		}))
+		assert.NoError(t, db.InsertRow(page.Type_PlaylistTree, &playlist.Playlist{
+			PlaylistHeader: playlist.PlaylistHeader{Id: 2, ParentId: 1},
+			Name:           "Friday",
+		}))
+		for _, entry := range entries {
+			assert.NoError(t, db.InsertRow(page.Type_PlaylistEntries, entry))
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	db := export(t, []*playlist.Entry{
+		{EntryIndex: 1, TrackID: 3, PlaylistID: 2},
+		{EntryIndex: 2, TrackID: 40, PlaylistID: 2},
+	})
+	assert.Empty(t, verify.Verify(db))
+}
+
+func TestVerify_Pristine(t *testing.T) {
+	f, err := os.Open("../../../testdata/pristine.pdb")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	db, err := dbengine.Open(f)
+	assert.NoError(t, err)
+	assert.Empty(t, verify.Verify(db))
+}
+
+func TestVerify_References(t *testing.T) {
+	db := export(t, []*playlist.Entry{
+		{EntryIndex: 1, TrackID: 41, PlaylistID: 2},
+		{EntryIndex: 2, TrackID: 1, PlaylistID: 1},
+	})
+
+	messages := make([]string, 0)
+	for _, problem := range verify.Verify(db) {
+		messages = append(messages, problem.Message)
+	}
+	assert.Equal(t, []string{
+		"playlist 2 entry 1: TrackID 41 not found",
+		"playlist 1 entry 2: playlist is a folder",
+	}, messages)
+}
+
+func TestVerify_PageChain(t *testing.T) {
+	db := export(t, nil)
+
+	// Cut the chain of the tracks table short.
+	for i := range db.Globals.Pointers {
+		if db.Globals.Pointers[i].Type == page.Type_Tracks {
+			db.Globals.Pointers[i].LastPage = db.Globals.NextUnusedPage + 10
+		}
+	}
+
+	problems := verify.Verify(db)
+	assert.NotEmpty(t, problems)
+	assert.Equal(t, page.Type_Tracks, problems[0].Table)
+	assert.Contains(t, problems[len(problems)-1].String(), "page chain does not reach the last page")
+}
+
+func TestVerify_IndexFlags(t *testing.T) {
+	f := dbtest.Copy(t, "../../../testdata/pristine.pdb")
+	dbtest.DamageIndex(t, f, page.Type_Artists)
+
+	problems := verify.Verify(dbtest.Open(t, f))
+	assert.NotEmpty(t, problems)
+	assert.Equal(t, page.Type_Artists, problems[0].Table)
+	assert.Contains(t, problems[0].String(), "index page has flags 0x24")
+}